@@ -0,0 +1,624 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"gopkg.in/yaml.v2"
+)
+
+// 标准 jaeger 环境变量
+const (
+	envServiceName         = "JAEGER_SERVICE_NAME"
+	envDisabled            = "JAEGER_DISABLED"
+	envAgentHost           = "JAEGER_AGENT_HOST"
+	envAgentPort           = "JAEGER_AGENT_PORT"
+	envEndpoint            = "JAEGER_ENDPOINT"
+	envSamplerType         = "JAEGER_SAMPLER_TYPE"
+	envSamplerParam        = "JAEGER_SAMPLER_PARAM"
+	envReporterMaxQueue    = "JAEGER_REPORTER_MAX_QUEUE_SIZE"
+	envReporterFlush       = "JAEGER_REPORTER_FLUSH_INTERVAL"
+	envReporterLogSpans    = "JAEGER_REPORTER_LOG_SPANS"
+	envTags                = "JAEGER_TAGS"
+	envRPCMetrics          = "JAEGER_RPC_METRICS"
+	envPropagation         = "JAEGER_PROPAGATION"
+	envSamplingEndpoint    = "JAEGER_SAMPLING_ENDPOINT"
+	envSamplerRefresh      = "JAEGER_SAMPLER_REFRESH_INTERVAL"
+	envSamplerMaxOps       = "JAEGER_SAMPLER_MAX_OPERATIONS"
+	envUser                = "JAEGER_USER"
+	envPassword            = "JAEGER_PASSWORD"
+	envReconnectDisabled   = "JAEGER_REPORTER_ATTEMPT_RECONNECTING_DISABLED"
+	envReconnectInterval   = "JAEGER_REPORTER_ATTEMPT_RECONNECT_INTERVAL"
+	envOTLPEndpoint        = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	envOTLPProtocol        = "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"
+	envOTLPHeaders         = "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	envOTLPCompression     = "OTEL_EXPORTER_OTLP_TRACES_COMPRESSION"
+	defaultAgentHost       = "127.0.0.1"
+	defaultAgentPortString = "6831"
+)
+
+type (
+	// Config 链路追踪配置，对应 jaegerTracerOptions
+	// 可以直接嵌入到业务自己的配置结构中作为一个配置段，也可以通过 LoadConfigFile 单独加载
+	// 指针类型的字段为 nil 表示未设置
+	Config struct {
+		ServiceName   string            `yaml:"serviceName" json:"serviceName"`
+		AgentHostPort string            `yaml:"agentHostPort" json:"agentHostPort"`
+		Disabled      *bool             `yaml:"disabled" json:"disabled"`
+		Log           *bool             `yaml:"log" json:"log"`
+		RPCMetrics    *bool             `yaml:"rpcMetrics" json:"rpcMetrics"`
+		Tags          map[string]string `yaml:"tags" json:"tags"`
+		Propagation   []string          `yaml:"propagation" json:"propagation"`
+		Sampler       SamplerConfig     `yaml:"sampler" json:"sampler"`
+		Reporter      ReporterConfig    `yaml:"reporter" json:"reporter"`
+	}
+
+	// SamplerConfig 采样配置
+	SamplerConfig struct {
+		Type                     string    `yaml:"type" json:"type"`
+		Param                    *float64  `yaml:"param" json:"param"`
+		SamplingServerURL        string    `yaml:"samplingServerURL" json:"samplingServerURL"`
+		SamplingRefreshInterval  *Duration `yaml:"samplingRefreshInterval" json:"samplingRefreshInterval"`
+		MaxOperations            int       `yaml:"maxOperations" json:"maxOperations"`
+		OperationNameLateBinding *bool     `yaml:"operationNameLateBinding" json:"operationNameLateBinding"`
+		StrategiesFile           string    `yaml:"strategiesFile" json:"strategiesFile"`
+		StrategiesReloadInterval *Duration `yaml:"strategiesReloadInterval" json:"strategiesReloadInterval"`
+		TailWindow               *Duration `yaml:"tailWindow" json:"tailWindow"`
+		TailLatency              *Duration `yaml:"tailLatency" json:"tailLatency"`
+		TailBaseRate             *float64  `yaml:"tailBaseRate" json:"tailBaseRate"`
+		TailMaxSpans             int       `yaml:"tailMaxSpans" json:"tailMaxSpans"`
+	}
+
+	// ReporterConfig 上报配置
+	ReporterConfig struct {
+		CollectorEndpoint          string            `yaml:"collectorEndpoint" json:"collectorEndpoint"`
+		QueueSize                  int               `yaml:"queueSize" json:"queueSize"`
+		LogSpans                   *bool             `yaml:"logSpans" json:"logSpans"`
+		BufferFlushInterval        *Duration         `yaml:"bufferFlushInterval" json:"bufferFlushInterval"`
+		DisableAttemptReconnecting *bool             `yaml:"disableAttemptReconnecting" json:"disableAttemptReconnecting"`
+		AttemptReconnectInterval   *Duration         `yaml:"attemptReconnectInterval" json:"attemptReconnectInterval"`
+		User                       string            `yaml:"user" json:"user"`
+		Password                   string            `yaml:"password" json:"password"`
+		HTTPHeaders                map[string]string `yaml:"httpHeaders" json:"httpHeaders"`
+		OTLPEndpoint               string            `yaml:"otlpEndpoint" json:"otlpEndpoint"`
+		OTLPProtocol               string            `yaml:"otlpProtocol" json:"otlpProtocol"`
+		OTLPHeaders                map[string]string `yaml:"otlpHeaders" json:"otlpHeaders"`
+		OTLPCompression            string            `yaml:"otlpCompression" json:"otlpCompression"`
+		FilePath                   string            `yaml:"filePath" json:"filePath"`
+		FileMaxSize                int64             `yaml:"fileMaxSize" json:"fileMaxSize"`
+		FileMaxBackups             *int              `yaml:"fileMaxBackups" json:"fileMaxBackups"`
+	}
+
+	// Duration 配置文件中的时长，支持 "1s"、"500ms" 这类字符串，也可以直接写纳秒数
+	Duration time.Duration
+)
+
+/*
+NewJaegerTracerFromConfig 从环境变量和配置文件创建 Jaeger 链路追踪器，并设置为全局追踪器
+优先级：显式传入的 Option > 配置文件 > JAEGER_* 环境变量
+Args:
+ - path: 配置文件路径，支持 .yaml/.yml/.json；为空时只读取环境变量
+*/
+func NewJaegerTracerFromConfig(path string, opts ...Option) (opentracing.Tracer, io.Closer, error) {
+	cfg, e := loadConfig(path)
+	if e != nil {
+		return nil, nil, e
+	}
+	return NewJaegerTracer(cfg.ServiceName, cfg.AgentHostPort, append(cfg.Options(), opts...)...)
+}
+
+/*
+NewTracerFromConfig 从环境变量和配置文件创建独立的 Jaeger 链路追踪器
+优先级：显式传入的 Option > 配置文件 > JAEGER_* 环境变量
+Args:
+ - path: 配置文件路径，支持 .yaml/.yml/.json；为空时只读取环境变量
+*/
+func NewTracerFromConfig(path string, opts ...Option) (*Tracer, error) {
+	cfg, e := loadConfig(path)
+	if e != nil {
+		return nil, e
+	}
+	return NewTracer(cfg.ServiceName, cfg.AgentHostPort, append(cfg.Options(), opts...)...)
+}
+
+func loadConfig(path string) (*Config, error) {
+	cfg, e := ConfigFromEnv()
+	if e != nil {
+		return nil, e
+	}
+	if path == "" {
+		return cfg, nil
+	}
+	fileCfg, e := LoadConfigFile(path)
+	if e != nil {
+		return nil, e
+	}
+	return cfg.Merge(fileCfg), nil
+}
+
+// LoadConfigFile 读取配置文件，根据扩展名选择 YAML(.yaml/.yml) 或 JSON(.json) 解析
+func LoadConfigFile(path string) (*Config, error) {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	cfg := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		e = yaml.Unmarshal(data, cfg)
+	case ".json":
+		e = json.Unmarshal(data, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config file type: %s", path)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("parse config file %s failed, err:%v", path, e)
+	}
+	return cfg, nil
+}
+
+// ConfigFromEnv 从标准 JAEGER_* 环境变量读取配置，值为空的环境变量视为未设置
+func ConfigFromEnv() (*Config, error) {
+	var e error
+	cfg := &Config{
+		ServiceName: os.Getenv(envServiceName),
+	}
+
+	if cfg.Disabled, e = envBool(envDisabled); e != nil {
+		return nil, e
+	}
+	if cfg.RPCMetrics, e = envBool(envRPCMetrics); e != nil {
+		return nil, e
+	}
+	if v, ok := lookupEnv(envTags); ok {
+		if cfg.Tags, e = parseEnvTags(v); e != nil {
+			return nil, e
+		}
+	}
+	if v := os.Getenv(envPropagation); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.Propagation = append(cfg.Propagation, p)
+			}
+		}
+	}
+
+	host, hasHost := lookupEnv(envAgentHost)
+	port, hasPort := lookupEnv(envAgentPort)
+	if hasHost || hasPort {
+		if !hasHost {
+			host = defaultAgentHost
+		}
+		if !hasPort {
+			port = defaultAgentPortString
+		}
+		cfg.AgentHostPort = host + ":" + port
+	}
+
+	cfg.Sampler.Type = os.Getenv(envSamplerType)
+	cfg.Sampler.SamplingServerURL = os.Getenv(envSamplingEndpoint)
+	if v, ok := lookupEnv(envSamplerParam); ok {
+		param, e := strconv.ParseFloat(v, 64)
+		if e != nil {
+			return nil, fmt.Errorf("cannot parse env var %s=%s, err:%v", envSamplerParam, v, e)
+		}
+		cfg.Sampler.Param = &param
+	}
+	if cfg.Sampler.SamplingRefreshInterval, e = envDuration(envSamplerRefresh); e != nil {
+		return nil, e
+	}
+	if cfg.Sampler.MaxOperations, e = envInt(envSamplerMaxOps); e != nil {
+		return nil, e
+	}
+
+	cfg.Reporter.CollectorEndpoint = os.Getenv(envEndpoint)
+	cfg.Reporter.User = os.Getenv(envUser)
+	cfg.Reporter.Password = os.Getenv(envPassword)
+	if cfg.Reporter.QueueSize, e = envInt(envReporterMaxQueue); e != nil {
+		return nil, e
+	}
+	if cfg.Reporter.BufferFlushInterval, e = envDuration(envReporterFlush); e != nil {
+		return nil, e
+	}
+	if cfg.Reporter.LogSpans, e = envBool(envReporterLogSpans); e != nil {
+		return nil, e
+	}
+	if cfg.Reporter.DisableAttemptReconnecting, e = envBool(envReconnectDisabled); e != nil {
+		return nil, e
+	}
+	if cfg.Reporter.AttemptReconnectInterval, e = envDuration(envReconnectInterval); e != nil {
+		return nil, e
+	}
+	cfg.Reporter.OTLPEndpoint = os.Getenv(envOTLPEndpoint)
+	cfg.Reporter.OTLPProtocol = os.Getenv(envOTLPProtocol)
+	cfg.Reporter.OTLPCompression = os.Getenv(envOTLPCompression)
+	if v, ok := lookupEnv(envOTLPHeaders); ok {
+		if cfg.Reporter.OTLPHeaders, e = parseEnvHeaders(envOTLPHeaders, v); e != nil {
+			return nil, e
+		}
+	}
+
+	return cfg, nil
+}
+
+// lookupEnv 读取环境变量，值为空时视为未设置
+func lookupEnv(name string) (string, bool) {
+	v := os.Getenv(name)
+	return v, v != ""
+}
+
+func envBool(name string) (*bool, error) {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil, nil
+	}
+	b, e := strconv.ParseBool(v)
+	if e != nil {
+		return nil, fmt.Errorf("cannot parse env var %s=%s, err:%v", name, v, e)
+	}
+	return &b, nil
+}
+
+func envInt(name string) (int, error) {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return 0, nil
+	}
+	i, e := strconv.Atoi(v)
+	if e != nil {
+		return 0, fmt.Errorf("cannot parse env var %s=%s, err:%v", name, v, e)
+	}
+	return i, nil
+}
+
+func envDuration(name string) (*Duration, error) {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil, nil
+	}
+	d, e := time.ParseDuration(v)
+	if e != nil {
+		return nil, fmt.Errorf("cannot parse env var %s=%s, err:%v", name, v, e)
+	}
+	duration := Duration(d)
+	return &duration, nil
+}
+
+// parseEnvHeaders 解析 "key1=value1,key2=value2" 格式的 header
+func parseEnvHeaders(name, v string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("cannot parse env var %s=%s, invalid header %q", name, v, pair)
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return headers, nil
+}
+
+// parseEnvTags 解析 JAEGER_TAGS，格式为 "key1=value1,key2=${ENV_NAME:default}"
+func parseEnvTags(v string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("cannot parse env var %s=%s, invalid tag %q", envTags, v, pair)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+			ed := strings.SplitN(value[2:len(value)-1], ":", 2)
+			value = os.Getenv(ed[0])
+			if value == "" && len(ed) == 2 {
+				value = ed[1]
+			}
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// Merge 用 other 中已设置的值覆盖当前配置，返回当前配置
+func (c *Config) Merge(other *Config) *Config {
+	if other == nil {
+		return c
+	}
+	if other.ServiceName != "" {
+		c.ServiceName = other.ServiceName
+	}
+	if other.AgentHostPort != "" {
+		c.AgentHostPort = other.AgentHostPort
+	}
+	if other.Disabled != nil {
+		c.Disabled = other.Disabled
+	}
+	if other.Log != nil {
+		c.Log = other.Log
+	}
+	if other.RPCMetrics != nil {
+		c.RPCMetrics = other.RPCMetrics
+	}
+	if len(other.Tags) > 0 {
+		if c.Tags == nil {
+			c.Tags = make(map[string]string, len(other.Tags))
+		}
+		for k, v := range other.Tags {
+			c.Tags[k] = v
+		}
+	}
+	if len(other.Propagation) > 0 {
+		c.Propagation = other.Propagation
+	}
+	if other.Sampler.Type != "" {
+		c.Sampler.Type = other.Sampler.Type
+	}
+	if other.Sampler.Param != nil {
+		c.Sampler.Param = other.Sampler.Param
+	}
+	if other.Sampler.SamplingServerURL != "" {
+		c.Sampler.SamplingServerURL = other.Sampler.SamplingServerURL
+	}
+	if other.Sampler.SamplingRefreshInterval != nil {
+		c.Sampler.SamplingRefreshInterval = other.Sampler.SamplingRefreshInterval
+	}
+	if other.Sampler.MaxOperations != 0 {
+		c.Sampler.MaxOperations = other.Sampler.MaxOperations
+	}
+	if other.Sampler.OperationNameLateBinding != nil {
+		c.Sampler.OperationNameLateBinding = other.Sampler.OperationNameLateBinding
+	}
+	if other.Sampler.StrategiesFile != "" {
+		c.Sampler.StrategiesFile = other.Sampler.StrategiesFile
+	}
+	if other.Sampler.StrategiesReloadInterval != nil {
+		c.Sampler.StrategiesReloadInterval = other.Sampler.StrategiesReloadInterval
+	}
+	if other.Sampler.TailWindow != nil {
+		c.Sampler.TailWindow = other.Sampler.TailWindow
+	}
+	if other.Sampler.TailLatency != nil {
+		c.Sampler.TailLatency = other.Sampler.TailLatency
+	}
+	if other.Sampler.TailBaseRate != nil {
+		c.Sampler.TailBaseRate = other.Sampler.TailBaseRate
+	}
+	if other.Sampler.TailMaxSpans != 0 {
+		c.Sampler.TailMaxSpans = other.Sampler.TailMaxSpans
+	}
+	if other.Reporter.CollectorEndpoint != "" {
+		c.Reporter.CollectorEndpoint = other.Reporter.CollectorEndpoint
+	}
+	if other.Reporter.QueueSize != 0 {
+		c.Reporter.QueueSize = other.Reporter.QueueSize
+	}
+	if other.Reporter.LogSpans != nil {
+		c.Reporter.LogSpans = other.Reporter.LogSpans
+	}
+	if other.Reporter.BufferFlushInterval != nil {
+		c.Reporter.BufferFlushInterval = other.Reporter.BufferFlushInterval
+	}
+	if other.Reporter.DisableAttemptReconnecting != nil {
+		c.Reporter.DisableAttemptReconnecting = other.Reporter.DisableAttemptReconnecting
+	}
+	if other.Reporter.AttemptReconnectInterval != nil {
+		c.Reporter.AttemptReconnectInterval = other.Reporter.AttemptReconnectInterval
+	}
+	if other.Reporter.User != "" {
+		c.Reporter.User = other.Reporter.User
+	}
+	if other.Reporter.Password != "" {
+		c.Reporter.Password = other.Reporter.Password
+	}
+	if len(other.Reporter.HTTPHeaders) > 0 {
+		if c.Reporter.HTTPHeaders == nil {
+			c.Reporter.HTTPHeaders = make(map[string]string, len(other.Reporter.HTTPHeaders))
+		}
+		for k, v := range other.Reporter.HTTPHeaders {
+			c.Reporter.HTTPHeaders[k] = v
+		}
+	}
+	if other.Reporter.OTLPEndpoint != "" {
+		c.Reporter.OTLPEndpoint = other.Reporter.OTLPEndpoint
+	}
+	if other.Reporter.OTLPProtocol != "" {
+		c.Reporter.OTLPProtocol = other.Reporter.OTLPProtocol
+	}
+	if other.Reporter.OTLPCompression != "" {
+		c.Reporter.OTLPCompression = other.Reporter.OTLPCompression
+	}
+	if other.Reporter.FilePath != "" {
+		c.Reporter.FilePath = other.Reporter.FilePath
+	}
+	if other.Reporter.FileMaxSize != 0 {
+		c.Reporter.FileMaxSize = other.Reporter.FileMaxSize
+	}
+	if other.Reporter.FileMaxBackups != nil {
+		c.Reporter.FileMaxBackups = other.Reporter.FileMaxBackups
+	}
+	if len(other.Reporter.OTLPHeaders) > 0 {
+		if c.Reporter.OTLPHeaders == nil {
+			c.Reporter.OTLPHeaders = make(map[string]string, len(other.Reporter.OTLPHeaders))
+		}
+		for k, v := range other.Reporter.OTLPHeaders {
+			c.Reporter.OTLPHeaders[k] = v
+		}
+	}
+	return c
+}
+
+// Options 把配置中已设置的值转换为 Option
+func (c *Config) Options() []Option {
+	var opts []Option
+	if c.Disabled != nil {
+		opts = append(opts, WithDisable(*c.Disabled))
+	}
+	if c.Log != nil {
+		opts = append(opts, WithLog(*c.Log))
+	}
+	if c.RPCMetrics != nil {
+		opts = append(opts, WithRPCMetrics(*c.RPCMetrics))
+	}
+	if len(c.Tags) > 0 {
+		keys := make([]string, 0, len(c.Tags))
+		for k := range c.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tags := make([]opentracing.Tag, 0, len(keys))
+		for _, k := range keys {
+			tags = append(tags, opentracing.Tag{Key: k, Value: c.Tags[k]})
+		}
+		opts = append(opts, WithTags(tags...))
+	}
+	if len(c.Propagation) > 0 {
+		propagations := make([]Propagation, 0, len(c.Propagation))
+		for _, p := range c.Propagation {
+			propagations = append(propagations, Propagation(p))
+		}
+		opts = append(opts, WithPropagation(propagations...))
+	}
+	if c.Sampler.Type != "" {
+		opts = append(opts, WithSamplerType(c.Sampler.Type))
+	}
+	if c.Sampler.Param != nil {
+		opts = append(opts, WithSamplerParam(*c.Sampler.Param))
+	}
+	if c.Sampler.SamplingServerURL != "" {
+		opts = append(opts, WithSamplingServerURL(c.Sampler.SamplingServerURL))
+	}
+	if c.Sampler.SamplingRefreshInterval != nil {
+		opts = append(opts, WithSamplingRefreshInterval(time.Duration(*c.Sampler.SamplingRefreshInterval)))
+	}
+	if c.Sampler.MaxOperations != 0 {
+		opts = append(opts, WithSamplerMaxOperations(c.Sampler.MaxOperations))
+	}
+	if c.Sampler.OperationNameLateBinding != nil {
+		opts = append(opts, WithSamplerOperationNameLateBinding(*c.Sampler.OperationNameLateBinding))
+	}
+	if c.Sampler.StrategiesFile != "" {
+		var interval time.Duration
+		if c.Sampler.StrategiesReloadInterval != nil {
+			interval = time.Duration(*c.Sampler.StrategiesReloadInterval)
+		}
+		opts = append(opts, WithPerOperationSamplingFile(c.Sampler.StrategiesFile, interval))
+	}
+	if c.Sampler.TailWindow != nil {
+		var latency time.Duration
+		var baseRate float64
+		if c.Sampler.TailLatency != nil {
+			latency = time.Duration(*c.Sampler.TailLatency)
+		}
+		if c.Sampler.TailBaseRate != nil {
+			baseRate = *c.Sampler.TailBaseRate
+		}
+		opts = append(opts, WithTailSampling(time.Duration(*c.Sampler.TailWindow), latency, baseRate))
+	}
+	if c.Sampler.TailMaxSpans != 0 {
+		opts = append(opts, WithTailSamplingMaxSpans(c.Sampler.TailMaxSpans))
+	}
+	if c.Reporter.CollectorEndpoint != "" {
+		opts = append(opts, WithCollectorEndpoint(c.Reporter.CollectorEndpoint))
+	}
+	if c.Reporter.QueueSize != 0 {
+		opts = append(opts, WithReporterQueueSize(c.Reporter.QueueSize))
+	}
+	if c.Reporter.LogSpans != nil {
+		opts = append(opts, WithReporterLogSpans(*c.Reporter.LogSpans))
+	}
+	if c.Reporter.BufferFlushInterval != nil {
+		opts = append(opts, WithBufferFlushInterval(time.Duration(*c.Reporter.BufferFlushInterval)))
+	}
+	if c.Reporter.DisableAttemptReconnecting != nil {
+		opts = append(opts, WithDisableAttemptReconnecting(*c.Reporter.DisableAttemptReconnecting))
+	}
+	if c.Reporter.AttemptReconnectInterval != nil {
+		opts = append(opts, WithAttemptReconnectInterval(time.Duration(*c.Reporter.AttemptReconnectInterval)))
+	}
+	if c.Reporter.User != "" || c.Reporter.Password != "" {
+		opts = append(opts, WithCollectorBasicAuth(c.Reporter.User, c.Reporter.Password))
+	}
+	if len(c.Reporter.HTTPHeaders) > 0 {
+		opts = append(opts, WithCollectorHTTPHeaders(c.Reporter.HTTPHeaders))
+	}
+	if c.Reporter.OTLPEndpoint != "" {
+		opts = append(opts, WithOTLPEndpoint(c.Reporter.OTLPEndpoint))
+	}
+	if c.Reporter.OTLPProtocol != "" {
+		opts = append(opts, WithOTLPProtocol(c.Reporter.OTLPProtocol))
+	}
+	if c.Reporter.OTLPCompression != "" {
+		opts = append(opts, WithOTLPCompression(c.Reporter.OTLPCompression))
+	}
+	if len(c.Reporter.OTLPHeaders) > 0 {
+		opts = append(opts, WithOTLPHeaders(c.Reporter.OTLPHeaders))
+	}
+	if c.Reporter.FilePath != "" {
+		opts = append(opts, WithFileReporter(c.Reporter.FilePath))
+	}
+	if c.Reporter.FileMaxSize != 0 || c.Reporter.FileMaxBackups != nil {
+		maxBackups := fileReporterDefaultMaxBackups
+		if c.Reporter.FileMaxBackups != nil {
+			maxBackups = *c.Reporter.FileMaxBackups
+		}
+		opts = append(opts, WithFileReporterRotation(c.Reporter.FileMaxSize, maxBackups))
+	}
+	return opts
+}
+
+// UnmarshalYAML 解析 "1s" 格式的时长或纳秒数
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if e := unmarshal(&v); e != nil {
+		return e
+	}
+	switch value := v.(type) {
+	case int:
+		*d = Duration(value)
+	case int64:
+		*d = Duration(value)
+	case uint64:
+		*d = Duration(value)
+	case float64:
+		*d = Duration(value)
+	case string:
+		interval, e := time.ParseDuration(value)
+		if e != nil {
+			return e
+		}
+		*d = Duration(interval)
+	default:
+		return fmt.Errorf("invalid duration: %v", v)
+	}
+	return nil
+}
+
+// UnmarshalJSON 解析 "1s" 格式的时长或纳秒数
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if e := json.Unmarshal(data, &v); e != nil {
+		return e
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		interval, e := time.ParseDuration(value)
+		if e != nil {
+			return e
+		}
+		*d = Duration(interval)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package trace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if e := os.WriteFile(path, []byte(content), 0644); e != nil {
+		t.Fatal(e)
+	}
+	return path
+}
+
+func TestConfigFromEnvEmpty(t *testing.T) {
+	for _, name := range []string{"JAEGER_TAGS", "JAEGER_DISABLED", "JAEGER_SAMPLER_PARAM", "JAEGER_AGENT_PORT",
+		"JAEGER_REPORTER_MAX_QUEUE_SIZE", "JAEGER_REPORTER_FLUSH_INTERVAL", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		t.Setenv(name, "")
+	}
+	cfg, e := trace.ConfigFromEnv()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if cfg.Tags != nil || cfg.Disabled != nil || cfg.Sampler.Param != nil || cfg.AgentHostPort != "" ||
+		cfg.Reporter.QueueSize != 0 || cfg.Reporter.BufferFlushInterval != nil || cfg.Reporter.OTLPHeaders != nil {
+		t.Errorf("empty env vars are not unset: %+v", cfg)
+	}
+}
+
+func TestConfigDuration(t *testing.T) {
+	content := map[string]string{
+		"config.yaml": "reporter:\n  bufferFlushInterval: 2s\n  attemptReconnectInterval: 3000000000\n",
+		"config.json": `{"reporter": {"bufferFlushInterval": "2s", "attemptReconnectInterval": 3000000000}}`,
+	}
+	for name, c := range content {
+		cfg, e := trace.LoadConfigFile(writeConfigFile(t, name, c))
+		if e != nil {
+			t.Fatalf("%s: %v", name, e)
+		}
+		if d := cfg.Reporter.BufferFlushInterval; d == nil || time.Duration(*d) != 2*time.Second {
+			t.Errorf("%s: bufferFlushInterval = %v", name, d)
+		}
+		if d := cfg.Reporter.AttemptReconnectInterval; d == nil || time.Duration(*d) != 3*time.Second {
+			t.Errorf("%s: attemptReconnectInterval = %v", name, d)
+		}
+	}
+}
+
+func TestConfigMergeCredentials(t *testing.T) {
+	env := &trace.Config{Reporter: trace.ReporterConfig{User: "env-user", Password: "env-password"}}
+	env.Merge(&trace.Config{Reporter: trace.ReporterConfig{User: "file-user"}})
+	if env.Reporter.User != "file-user" || env.Reporter.Password != "env-password" {
+		t.Errorf("user = %q, password = %q", env.Reporter.User, env.Reporter.Password)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	t.Setenv("JAEGER_SERVICE_NAME", "env-service")
+	t.Setenv("JAEGER_SAMPLER_TYPE", "const")
+	t.Setenv("JAEGER_SAMPLER_PARAM", "0")
+	t.Setenv("JAEGER_TAGS", "env=1,layer=env")
+	path := writeConfigFile(t, "config.yaml", "serviceName: file-service\nsampler:\n  param: 1\ntags:\n  layer: file\n")
+
+	cases := map[string]struct {
+		opts    []trace.Option
+		sampled bool
+	}{
+		"file over env":    {sampled: true},
+		"options over all": {opts: []trace.Option{trace.WithSamplerParam(0)}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tracer, e := trace.NewTracerFromConfig(path, append(c.opts,
+				trace.WithReporter(jaeger.NewInMemoryReporter()), trace.WithReporterLogSpans(false))...)
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer tracer.Close()
+
+			if tracer.ServiceName() != "file-service" {
+				t.Errorf("service name = %q", tracer.ServiceName())
+			}
+			span := tracer.StartSpan("span").(*jaeger.Span)
+			defer span.Finish()
+			if sampled := span.SpanContext().IsSampled(); sampled != c.sampled {
+				t.Errorf("sampled = %v, want %v", sampled, c.sampled)
+			}
+			tags := map[string]interface{}{}
+			for _, tag := range span.Tracer().(*jaeger.Tracer).Tags() {
+				tags[tag.Key] = tag.Value
+			}
+			if tags["env"] != "1" || tags["layer"] != "file" {
+				t.Errorf("tracer tags = %v", tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	fileReporterDefaultMaxBackups = 3
+	fileReporterMaxLineSize       = 16 * 1024 * 1024
+)
+
+type (
+	// SpanRecord 文件 reporter 中每一行的 span 记录，可以通过 ReadSpanRecords 重新读取
+	SpanRecord struct {
+		TraceID       string                 `json:"traceId"`
+		SpanID        string                 `json:"spanId"`
+		ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+		ServiceName   string                 `json:"serviceName"`
+		OperationName string                 `json:"operationName"`
+		StartTime     time.Time              `json:"startTime"`
+		Duration      time.Duration          `json:"duration"`
+		Sampled       bool                   `json:"sampled"`
+		Tags          map[string]interface{} `json:"tags,omitempty"`
+		Logs          []SpanLogRecord        `json:"logs,omitempty"`
+		References    []SpanRefRecord        `json:"references,omitempty"`
+	}
+
+	// SpanLogRecord span 中的一条 log
+	SpanLogRecord struct {
+		Timestamp time.Time              `json:"timestamp"`
+		Fields    map[string]interface{} `json:"fields"`
+	}
+
+	// SpanRefRecord span 引用的其他 span，Type 为 "child_of" 或 "follows_from"
+	SpanRefRecord struct {
+		Type    string `json:"type"`
+		TraceID string `json:"traceId"`
+		SpanID  string `json:"spanId"`
+	}
+
+	// fileReporter 把每个结束的 span 以一行 JSON 追加写入文件，超过 maxSize 后按 path.1、path.2 ... 轮转
+	fileReporter struct {
+		serviceName   string
+		path          string
+		maxSize       int64
+		maxBackups    int
+		logger        jaeger.Logger
+		metrics       *jaeger.Metrics
+		queue         chan *jaeger.Span
+		flushInterval time.Duration
+
+		file      *os.File
+		writer    *bufio.Writer
+		size      int64
+		closeOnce sync.Once
+		closed    chan struct{}
+		done      chan struct{}
+	}
+)
+
+// ReadSpanRecords 读取文件 reporter 写入的 JSON lines
+func ReadSpanRecords(r io.Reader) ([]SpanRecord, error) {
+	var records []SpanRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), fileReporterMaxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := SpanRecord{}
+		if e := json.Unmarshal(line, &record); e != nil {
+			return records, e
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// ReadSpanRecordsFile 读取文件 reporter 写入的文件
+func ReadSpanRecordsFile(path string) ([]SpanRecord, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	return ReadSpanRecords(f)
+}
+
+// NewSpanRecord 把 jaeger span 转换为 SpanRecord
+func NewSpanRecord(serviceName string, span *jaeger.Span) SpanRecord {
+	spanCtx := span.SpanContext()
+	record := SpanRecord{
+		TraceID:       spanCtx.TraceID().String(),
+		SpanID:        spanCtx.SpanID().String(),
+		ServiceName:   serviceName,
+		OperationName: span.OperationName(),
+		StartTime:     span.StartTime(),
+		Duration:      span.Duration(),
+		Sampled:       spanCtx.IsSampled(),
+	}
+	if spanCtx.ParentID() != 0 {
+		record.ParentSpanID = spanCtx.ParentID().String()
+	}
+
+	if tags := span.Tags(); len(tags) > 0 {
+		record.Tags = make(map[string]interface{}, len(tags))
+		for k, v := range tags {
+			record.Tags[k] = recordValue(v)
+		}
+	}
+	for _, log := range span.Logs() {
+		logRecord := SpanLogRecord{Timestamp: log.Timestamp, Fields: make(map[string]interface{}, len(log.Fields))}
+		for _, field := range log.Fields {
+			logRecord.Fields[field.Key()] = recordValue(field.Value())
+		}
+		record.Logs = append(record.Logs, logRecord)
+	}
+	for _, ref := range span.References() {
+		refCtx, ok := ref.ReferencedContext.(jaeger.SpanContext)
+		if !ok {
+			continue
+		}
+		refType := "child_of"
+		if ref.Type == opentracing.FollowsFromRef {
+			refType = "follows_from"
+		}
+		record.References = append(record.References, SpanRefRecord{
+			Type:    refType,
+			TraceID: refCtx.TraceID().String(),
+			SpanID:  refCtx.SpanID().String(),
+		})
+	}
+	return record
+}
+
+func recordValue(v interface{}) interface{} {
+	switch v.(type) {
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func newFileReporter(serviceName, path string, maxSize int64, maxBackups int, queueSize int,
+	flushInterval time.Duration, logger jaeger.Logger, metrics *jaeger.Metrics) (*fileReporter, error) {
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	if logger == nil {
+		logger = jaeger.NullLogger
+	}
+	r := &fileReporter{
+		serviceName:   serviceName,
+		path:          path,
+		maxSize:       maxSize,
+		maxBackups:    maxBackups,
+		logger:        logger,
+		metrics:       metrics,
+		queue:         make(chan *jaeger.Span, queueSize),
+		flushInterval: flushInterval,
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if e := r.open(); e != nil {
+		return nil, e
+	}
+	go r.processQueue()
+	return r, nil
+}
+
+// Report 实现 jaeger.Reporter，队列满时丢弃 span
+func (r *fileReporter) Report(span *jaeger.Span) {
+	select {
+	case r.queue <- span.Retain():
+	default:
+		span.Release()
+		r.metrics.ReporterDropped.Inc(1)
+	}
+}
+
+// Close 实现 jaeger.Reporter，写入队列中剩余的 span 后关闭文件
+func (r *fileReporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		<-r.done
+		if e := r.closeFile(); e != nil {
+			r.logger.Error(fmt.Sprintf("close span file %s failed, err:%v", r.path, e))
+		}
+	})
+}
+
+func (r *fileReporter) processQueue() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case span := <-r.queue:
+			r.write(span)
+		case <-ticker.C:
+			if r.writer == nil {
+				continue
+			}
+			if e := r.writer.Flush(); e != nil {
+				r.logger.Error(fmt.Sprintf("flush span file %s failed, err:%v", r.path, e))
+			}
+		case <-r.closed:
+			for {
+				select {
+				case span := <-r.queue:
+					r.write(span)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *fileReporter) write(span *jaeger.Span) {
+	record := NewSpanRecord(r.serviceName, span)
+	span.Release()
+
+	line, e := json.Marshal(record)
+	if e != nil {
+		r.logger.Error(fmt.Sprintf("marshal span record failed, err:%v", e))
+		r.metrics.ReporterFailure.Inc(1)
+		return
+	}
+	line = append(line, '\n')
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		// 轮转失败时 rotate 会重新打开原文件，继续写入
+		if e = r.rotate(); e != nil {
+			r.logger.Error(fmt.Sprintf("rotate span file %s failed, err:%v", r.path, e))
+		}
+	}
+	// 之前重新打开文件失败时再次尝试
+	if r.writer == nil {
+		if e = r.open(); e != nil {
+			r.logger.Error(fmt.Sprintf("open span file %s failed, err:%v", r.path, e))
+			r.metrics.ReporterFailure.Inc(1)
+			return
+		}
+	}
+	n, e := r.writer.Write(line)
+	r.size += int64(n)
+	if e != nil {
+		r.logger.Error(fmt.Sprintf("write span file %s failed, err:%v", r.path, e))
+		r.metrics.ReporterFailure.Inc(1)
+		return
+	}
+	r.metrics.ReporterSuccess.Inc(1)
+}
+
+func (r *fileReporter) open() error {
+	f, e := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return e
+	}
+	info, e := f.Stat()
+	if e != nil {
+		_ = f.Close()
+		return e
+	}
+	r.file, r.writer, r.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+func (r *fileReporter) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	if e := r.writer.Flush(); e != nil {
+		_ = r.file.Close()
+		return e
+	}
+	return r.file.Close()
+}
+
+// rotate path.N-1 -> path.N ... path -> path.1，超过 maxBackups 的旧文件被删除
+// 无论轮转是否成功都会重新打开 path，重新打开失败时 file 为 nil，下次写入时再尝试
+func (r *fileReporter) rotate() error {
+	e := r.closeFile()
+	if e == nil {
+		e = r.rotateFiles()
+	}
+	if openErr := r.open(); openErr != nil {
+		r.file, r.writer = nil, nil
+		if e == nil {
+			e = openErr
+		}
+	}
+	return e
+}
+
+func (r *fileReporter) rotateFiles() error {
+	if r.maxBackups <= 0 {
+		if e := os.Remove(r.path); e != nil && !os.IsNotExist(e) {
+			return e
+		}
+		return nil
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		e := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		if e != nil && !os.IsNotExist(e) {
+			return e
+		}
+	}
+	return os.Rename(r.path, r.path+".1")
+}
@@ -0,0 +1,80 @@
+package trace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+func writeFileSpans(t *testing.T, path string, names []string, opts ...trace.Option) *trace.Tracer {
+	tracer, e := trace.NewTracer("file-test", "",
+		append([]trace.Option{trace.WithFileReporter(path), trace.WithReporterLogSpans(false)}, opts...)...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, name := range names {
+		tracer.StartSpan(name).Finish()
+	}
+	_ = tracer.Close()
+	return tracer
+}
+
+func readFileSpanNames(t *testing.T, path string) []string {
+	records, e := trace.ReadSpanRecordsFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.ServiceName != "file-test" || record.TraceID == "" || record.SpanID == "" {
+			t.Errorf("unexpected record: %+v", record)
+		}
+		names = append(names, record.OperationName)
+	}
+	return names
+}
+
+func TestFileReporterWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer := writeFileSpans(t, path, []string{"a", "b", "c"})
+
+	if names := readFileSpanNames(t, path); len(names) != 3 || names[0] != "a" || names[2] != "c" {
+		t.Errorf("spans = %v", names)
+	}
+	if s := tracer.Stats().Reporters["file"]; s.Flushed != 3 || s.Failed != 0 {
+		t.Errorf("unexpected stats: %s", s)
+	}
+}
+
+func TestFileReporterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	// 每个文件只能写入一个 span，每次写入前都会轮转
+	writeFileSpans(t, path, []string{"a", "b", "c", "d", "e"}, trace.WithFileReporterRotation(1, 2))
+
+	for file, want := range map[string]string{path: "e", path + ".1": "d", path + ".2": "c"} {
+		if names := readFileSpanNames(t, file); len(names) != 1 || names[0] != want {
+			t.Errorf("%s: spans = %v, want [%s]", filepath.Base(file), names, want)
+		}
+	}
+	if _, e := os.Stat(path + ".3"); !os.IsNotExist(e) {
+		t.Errorf("backup beyond max backups kept, err:%v", e)
+	}
+}
+
+func TestFileReporterRotationFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	// path.1 是非空目录，path 无法重命名为 path.1
+	if e := os.MkdirAll(filepath.Join(path+".1", "keep"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	tracer := writeFileSpans(t, path, []string{"a", "b", "c"}, trace.WithFileReporterRotation(1, 1))
+
+	if names := readFileSpanNames(t, path); len(names) != 3 {
+		t.Errorf("spans = %v, want all spans in %s", names, filepath.Base(path))
+	}
+	if s := tracer.Stats().Reporters["file"]; s.Flushed != 3 || s.Failed != 0 {
+		t.Errorf("unexpected stats: %s", s)
+	}
+}
@@ -0,0 +1,54 @@
+package tracemid
+
+import (
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// baggageTagKeys 需要提升为 span tag 的 baggage key，类型为 []string
+var baggageTagKeys atomic.Value
+
+// SetBaggage 在当前 span 上设置 baggage，随链路传递到下游服务，ctx 中没有 span 时返回 false
+// ctx 可以是 *gin.Context、context.Context 或通过 RegisterContextResolver 注册的类型
+func SetBaggage(ctx interface{}, key, value string) bool {
+	span := opentracing.SpanFromContext(getContext(ctx))
+	if span == nil {
+		return false
+	}
+	span.SetBaggageItem(key, value)
+	return true
+}
+
+// Baggage 读取当前 span 上的 baggage，不存在时返回空字符串
+// ctx 可以是 *gin.Context、context.Context 或通过 RegisterContextResolver 注册的类型
+func Baggage(ctx interface{}, key string) string {
+	span := opentracing.SpanFromContext(getContext(ctx))
+	if span == nil {
+		return ""
+	}
+	return span.BaggageItem(key)
+}
+
+/*
+SetBaggageTags 设置需要提升为 span tag 的 baggage key，SetGinTraceMid、HTTPHandler 和 GRPCServerTracerInterceptor 等
+创建 span 时把上游传入的这些 baggage 设置为同名 tag，便于在 jaeger 中按租户、用户等过滤
+重复调用会覆盖之前的设置，不传参数时关闭，中间件通过 WithGinBaggageTags 等选项单独设置时不使用全局设置
+Args:
+ - keys: baggage key，例如 "tenant-id"、"user-id"
+*/
+func SetBaggageTags(keys ...string) {
+	baggageTagKeys.Store(append([]string(nil), keys...))
+}
+
+// PromoteBaggageTags 把 keys 对应的 baggage 设置为 span tag，不传 keys 时使用 SetBaggageTags 的全局设置
+func PromoteBaggageTags(span opentracing.Span, keys ...string) {
+	if len(keys) == 0 {
+		keys, _ = baggageTagKeys.Load().([]string)
+	}
+	for _, key := range keys {
+		if value := span.BaggageItem(key); value != "" {
+			span.SetTag(key, value)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tracemid
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	captureDefaultMaxBodySize = 4096
+	captureMask               = "***"
+)
+
+var (
+	// 只有 json 和 form 会按字段掩码，默认不采集其他类型的 body
+	captureDefaultContentTypes = []string{"application/json", "application/x-www-form-urlencoded"}
+	captureDefaultMaskFields   = []string{"authorization", "cookie", "set-cookie", "password"}
+)
+
+type (
+	// CaptureConfig 请求、响应内容采集配置，内容以 span 日志记录，只采集已被采样的 span
+	CaptureConfig struct {
+		SampleRate   float64  // 采集比例，0 到 1 之间，为 0 时不采集
+		MaxBodySize  int      // body 最多记录的字节数，默认 4096，超出部分截断
+		AllowHeaders []string // 记录的请求头，为空时记录全部请求头
+		DenyHeaders  []string // 不记录的请求头，优先于 AllowHeaders
+		ContentTypes []string // 记录 body 的 Content-Type，默认 json 和 form，其他类型的 body 不掩码、原样记录
+		MaskFields   []string // 在默认的 Authorization、Cookie、Set-Cookie、password 之外需要掩码的请求头、query 参数和 body 字段，不区分大小写
+	}
+
+	// httpCapture 根据 CaptureConfig 采集 HTTP 内容
+	httpCapture struct {
+		sampleRate   float64
+		maxBodySize  int
+		allowHeaders map[string]bool
+		denyHeaders  map[string]bool
+		contentTypes []string
+		maskFields   map[string]bool
+		maskJSON     *regexp.Regexp
+	}
+
+	// captureResponseWriter 复制写入的响应 body，最多 max 字节
+	captureResponseWriter struct {
+		gin.ResponseWriter
+		body bytes.Buffer
+		max  int
+	}
+
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// WithGinCapture 设置 按比例采集请求头、query 参数、请求 body 和响应 body 并记录为 span 日志，默认不采集
+func WithGinCapture(cfg CaptureConfig) GinOption {
+	return func(opts *ginOptions) {
+		opts.capture = newHTTPCapture(cfg)
+	}
+}
+
+func newHTTPCapture(cfg CaptureConfig) *httpCapture {
+	c := &httpCapture{
+		sampleRate:   cfg.SampleRate,
+		maxBodySize:  cfg.MaxBodySize,
+		allowHeaders: lowerSet(cfg.AllowHeaders),
+		denyHeaders:  lowerSet(cfg.DenyHeaders),
+		contentTypes: cfg.ContentTypes,
+		maskFields:   lowerSet(append(append([]string(nil), captureDefaultMaskFields...), cfg.MaskFields...)),
+	}
+	if c.maxBodySize <= 0 {
+		c.maxBodySize = captureDefaultMaxBodySize
+	}
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = captureDefaultContentTypes
+	}
+	fields := make([]string, 0, len(c.maskFields))
+	for field := range c.maskFields {
+		fields = append(fields, regexp.QuoteMeta(field))
+	}
+	// body 可能被截断，无法完整解析 JSON，按正则替换字段值
+	c.maskJSON = regexp.MustCompile(`(?i)("(?:` + strings.Join(fields, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	return c
+}
+
+// sampled 判断本次请求是否采集，span 未被采样时不采集
+func (c *httpCapture) sampled(span opentracing.Span) bool {
+	if c == nil || c.sampleRate <= 0 {
+		return false
+	}
+	if !spanSampled(span) {
+		return false
+	}
+	return c.sampleRate >= 1 || rand.Float64() < c.sampleRate
+}
+
+// captureRequest 记录请求头、query 参数和请求 body，读取的 body 会放回请求中
+func (c *httpCapture) captureRequest(span opentracing.Span, req *http.Request) {
+	fields := []log.Field{log.String("event", "http.request")}
+	if headers := c.headers(req.Header); headers != "" {
+		fields = append(fields, log.String("http.request.headers", headers))
+	}
+	if req.URL.RawQuery != "" {
+		fields = append(fields, log.String("http.request.query", c.maskValues(req.URL.Query())))
+	}
+	if req.Body != nil && req.Body != http.NoBody && c.captureContentType(req.Header.Get("Content-Type")) {
+		buf, e := ioutil.ReadAll(io.LimitReader(req.Body, int64(c.maxBodySize)+1))
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+		if e != nil {
+			fields = append(fields, log.String("http.request.body.error", e.Error()))
+		} else if len(buf) > 0 {
+			fields = append(fields, c.bodyFields("http.request.body", req.Header.Get("Content-Type"), buf)...)
+		}
+	}
+	span.LogFields(fields...)
+}
+
+// captureResponse 记录响应 body
+func (c *httpCapture) captureResponse(span opentracing.Span, w *captureResponseWriter) {
+	contentType := w.Header().Get("Content-Type")
+	if w.body.Len() == 0 || !c.captureContentType(contentType) {
+		return
+	}
+	fields := []log.Field{log.String("event", "http.response")}
+	fields = append(fields, c.bodyFields("http.response.body", contentType, w.body.Bytes())...)
+	span.LogFields(fields...)
+}
+
+func (c *httpCapture) bodyFields(key, contentType string, body []byte) []log.Field {
+	truncated := len(body) > c.maxBodySize
+	if truncated {
+		body = body[:c.maxBodySize]
+	}
+	fields := []log.Field{log.String(key, c.maskBody(contentType, body))}
+	if truncated {
+		fields = append(fields, log.Bool(key+".truncated", true))
+	}
+	return fields
+}
+
+func (c *httpCapture) captureContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, e := mime.ParseMediaType(contentType)
+	if e != nil {
+		return false
+	}
+	for _, t := range c.contentTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// headers 按允许、禁止列表过滤请求头并掩码，返回 JSON
+func (c *httpCapture) headers(header http.Header) string {
+	values := make(map[string]string, len(header))
+	for key, vs := range header {
+		lower := strings.ToLower(key)
+		if c.denyHeaders[lower] || (len(c.allowHeaders) > 0 && !c.allowHeaders[lower]) {
+			continue
+		}
+		if c.maskFields[lower] {
+			values[key] = captureMask
+		} else {
+			values[key] = strings.Join(vs, ", ")
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func (c *httpCapture) maskValues(values url.Values) string {
+	for key, vs := range values {
+		if c.maskFields[strings.ToLower(key)] {
+			for i := range vs {
+				vs[i] = captureMask
+			}
+		}
+	}
+	return values.Encode()
+}
+
+func (c *httpCapture) maskBody(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch strings.ToLower(mediaType) {
+	case "application/json":
+		return c.maskJSON.ReplaceAllString(string(body), `${1}"`+captureMask+`"`)
+	case "application/x-www-form-urlencoded":
+		if values, e := url.ParseQuery(string(body)); e == nil {
+			return c.maskValues(values)
+		}
+	}
+	return string(body)
+}
+
+func newCaptureResponseWriter(w gin.ResponseWriter, max int) *captureResponseWriter {
+	return &captureResponseWriter{ResponseWriter: w, max: max}
+}
+
+// Write 实现 gin.ResponseWriter
+func (w *captureResponseWriter) Write(data []byte) (int, error) {
+	w.copy(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString 实现 gin.ResponseWriter
+func (w *captureResponseWriter) WriteString(s string) (int, error) {
+	w.copy([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// copy 多保留 1 字节用于判断是否截断
+func (w *captureResponseWriter) copy(data []byte) {
+	if remain := w.max + 1 - w.body.Len(); remain > 0 {
+		if len(data) > remain {
+			data = data[:remain]
+		}
+		w.body.Write(data)
+	}
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
@@ -2,34 +2,96 @@ package tracemid
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
-// getContext 兼容其他类型 context，例如 gin.Context
+// ContextResolver 从框架的 context 中取得 context.Context，无法解析时返回 false
+type ContextResolver func(ctx interface{}) (context.Context, bool)
+
+var (
+	resolverMu sync.RWMutex
+	// resolvers 通过 RegisterContextResolver 注册的解析函数，后注册的先执行
+	resolvers []ContextResolver
+	// builtinResolvers 内置的解析函数，在注册的解析函数之后执行
+	builtinResolvers = []ContextResolver{resolveGinContext, resolveStdContext}
+	// unresolvedTypes 已记录过日志的无法解析的类型
+	unresolvedTypes sync.Map
+	// unresolvedLogger 记录无法解析的类型的日志函数，类型为 func(format string, args ...interface{})
+	unresolvedLogger atomic.Value
+)
+
+/*
+RegisterContextResolver 注册 context 解析函数，用于从自定义框架的 context 中取得携带 span 的 context.Context
+SetBaggage、TraceIDFromContext、gorm 和请求中间件等通过解析函数获取父 span，后注册的解析函数优先，内置支持 gin 和 context.Context，echo 等框架的解析函数由对应的子包注册
+Args:
+ - resolver: 解析函数，无法解析时返回 false
+*/
+func RegisterContextResolver(resolver func(ctx interface{}) (context.Context, bool)) {
+	if resolver == nil {
+		return
+	}
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolvers = append([]ContextResolver{resolver}, resolvers...)
+}
+
+// SetUnresolvedContextLogger 设置 context 类型无法解析时的日志函数，例如 log.Printf，每种类型只记录一次，默认不记录，传 nil 时关闭
+func SetUnresolvedContextLogger(logger func(format string, args ...interface{})) {
+	unresolvedLogger.Store(logger)
+}
+
+// getContext 兼容其他类型 context，例如 gin.Context 和通过 RegisterContextResolver 注册的类型，无法解析时返回 context.Background()
 func getContext(iCtx interface{}) context.Context {
-	var ctx context.Context
-	switch c := iCtx.(type) {
-	case *gin.Context:
-		ctx = c.Request.Context()
-	case context.Context:
-		v := c.Value(_HTTP_FRAME_CTX_KEY)
-		if v == nil {
-			ctx = c
-		} else {
-			frame := v.(string)
-			switch frame {
-			case _HTTP_FRAME_GIN:
-				iReqCtx := c.Value(0)
-				reqCtx := iReqCtx.(*http.Request)
-				ctx = reqCtx.Context()
-			default:
-				ctx = c
-			}
+	resolverMu.RLock()
+	registered := resolvers
+	resolverMu.RUnlock()
+
+	for _, resolve := range registered {
+		if ctx, ok := resolve(iCtx); ok && ctx != nil {
+			return ctx
+		}
+	}
+	for _, resolve := range builtinResolvers {
+		if ctx, ok := resolve(iCtx); ok && ctx != nil {
+			return ctx
 		}
-	default:
+	}
+
+	// 每种类型只记录一次，避免刷屏
+	logger, _ := unresolvedLogger.Load().(func(format string, args ...interface{}))
+	if logger == nil {
 		return context.Background()
 	}
-	return ctx
+	if _, logged := unresolvedTypes.LoadOrStore(fmt.Sprintf("%T", iCtx), true); !logged {
+		logger("debug: tracemid cannot resolve context type %T, parent span is lost, "+
+			"register a resolver with RegisterContextResolver\n", iCtx)
+	}
+	return context.Background()
+}
+
+func resolveGinContext(iCtx interface{}) (context.Context, bool) {
+	c, ok := iCtx.(*gin.Context)
+	if !ok || c == nil || c.Request == nil {
+		return nil, false
+	}
+	return c.Request.Context(), true
+}
+
+// resolveStdContext 由 *gin.Context 派生的 context 通过 Value(0) 取得请求
+func resolveStdContext(iCtx interface{}) (context.Context, bool) {
+	c, ok := iCtx.(context.Context)
+	if !ok {
+		return nil, false
+	}
+	if frame, _ := c.Value(_HTTP_FRAME_CTX_KEY).(string); frame == _HTTP_FRAME_GIN {
+		if req, ok := c.Value(0).(*http.Request); ok {
+			return req.Context(), true
+		}
+	}
+	return c, true
 }
@@ -0,0 +1,24 @@
+package tracemid_test
+
+import (
+	"strings"
+	"testing"
+
+	tracemid "github.com/qxiong522/go-jaeger-trace/mid"
+)
+
+type unknownContext struct{}
+
+func TestUnresolvedContextLogger(t *testing.T) {
+	var logs []string
+	tracemid.SetUnresolvedContextLogger(func(format string, args ...interface{}) {
+		logs = append(logs, format)
+	})
+	defer tracemid.SetUnresolvedContextLogger(nil)
+
+	tracemid.Baggage(unknownContext{}, "user")
+	tracemid.Baggage(unknownContext{}, "user")
+	if len(logs) != 1 || !strings.Contains(logs[0], "RegisterContextResolver") {
+		t.Errorf("unexpected logs: %q", logs)
+	}
+}
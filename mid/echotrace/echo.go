@@ -0,0 +1,133 @@
+// Package echotrace echo 链路追踪中间件，独立为子模块，避免主模块依赖 echo
+package echotrace
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+
+	tracemid "github.com/qxiong522/go-jaeger-trace/mid"
+)
+
+const echoComponent = "Echo-Http"
+
+type (
+	EchoOption func(opts *echoOptions)
+
+	echoOptions struct {
+		operationNameFunc func(c echo.Context) string
+		clientErrors      bool
+		tracer            opentracing.Tracer
+		baggageTags       []string
+	}
+)
+
+// init 注册 echo.Context 的解析函数，SetBaggage、TraceIDFromContext、gorm 等可以直接传入 echo.Context
+func init() {
+	tracemid.RegisterContextResolver(resolveEchoContext)
+}
+
+// WithEchoOperationNameFunc 设置 span 的 operation 名称生成函数，默认为 "请求方法 路由模板"，例如 "GET /users/:id"
+func WithEchoOperationNameFunc(f func(c echo.Context) string) EchoOption {
+	return func(opts *echoOptions) {
+		if f != nil {
+			opts.operationNameFunc = f
+		}
+	}
+}
+
+// WithEchoClientErrors 设置 4xx 响应是否标记为错误，默认只有 5xx 标记为错误
+func WithEchoClientErrors(enable bool) EchoOption {
+	return func(opts *echoOptions) {
+		opts.clientErrors = enable
+	}
+}
+
+// WithEchoTracer 设置 使用的追踪器，默认使用 opentracing.GlobalTracer()
+func WithEchoTracer(tracer opentracing.Tracer) EchoOption {
+	return func(opts *echoOptions) {
+		opts.tracer = tracer
+	}
+}
+
+// WithEchoBaggageTags 设置 需要提升为 span tag 的 baggage key，不设置时使用 tracemid.SetBaggageTags 的全局设置
+func WithEchoBaggageTags(keys ...string) EchoOption {
+	return func(opts *echoOptions) {
+		opts.baggageTags = append([]string(nil), keys...)
+	}
+}
+
+// SetEchoTraceMid 创建 echo 链路追踪中间件，tag 与 SetGinTraceMid 一致
+func SetEchoTraceMid(opts ...EchoOption) echo.MiddlewareFunc {
+	options := &echoOptions{
+		operationNameFunc: echoOperationName,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tracer := options.tracer
+			if tracer == nil {
+				tracer = opentracing.GlobalTracer()
+			}
+			if tracer == nil {
+				return next(c)
+			}
+
+			req := c.Request()
+			startOpts := []opentracing.StartSpanOption{
+				opentracing.Tag{Key: string(ext.Component), Value: echoComponent},
+				ext.SpanKindRPCServer,
+			}
+			// 如果请求有带 tracer id 从父 span 生成子 span，否则生成新的 span
+			spCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+			if err == nil {
+				startOpts = append(startOpts, opentracing.ChildOf(spCtx))
+			}
+			span := tracer.StartSpan(options.operationNameFunc(c), startOpts...)
+			defer span.Finish()
+			// 记录 panic 后继续抛出，由 echo 的 Recover 等外层中间件处理
+			defer func() {
+				if r := recover(); r != nil {
+					tracemid.LogPanic(span, r)
+					tracemid.SetHTTPRequestTags(span, req, c.Path(), c.RealIP())
+					panic(r)
+				}
+			}()
+
+			tracemid.PromoteBaggageTags(span, options.baggageTags...)
+			c.SetRequest(req.WithContext(opentracing.ContextWithSpan(req.Context(), span)))
+
+			e := next(c)
+			if e != nil {
+				span.LogFields(log.String("event", "error"), log.String("message", e.Error()))
+				// 由错误处理函数写入响应，才能取得实际的状态码
+				c.Error(e)
+			}
+			tracemid.SetHTTPRequestTags(span, c.Request(), c.Path(), c.RealIP())
+			tracemid.SetHTTPStatusTags(span, c.Response().Status, options.clientErrors)
+			return e
+		}
+	}
+}
+
+// echoOperationName 使用路由模板命名，避免路径参数导致 operation 数量膨胀；未匹配到路由时不带路径
+func echoOperationName(c echo.Context) string {
+	if route := c.Path(); route != "" {
+		return c.Request().Method + " " + route
+	}
+	return c.Request().Method + " route not found"
+}
+
+func resolveEchoContext(iCtx interface{}) (context.Context, bool) {
+	c, ok := iCtx.(echo.Context)
+	if !ok || c.Request() == nil {
+		return nil, false
+	}
+	return c.Request().Context(), true
+}
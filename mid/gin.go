@@ -1,42 +1,233 @@
 package tracemid
 
 import (
+	"regexp"
+
 	"github.com/gin-gonic/gin"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
 )
 
+const ginComponent = "Gin-Http"
+
+type (
+	GinOption func(opts *ginOptions)
+
+	ginOptions struct {
+		operationNameFunc func(c *gin.Context) string
+		clientErrors      bool
+		tracer            opentracing.Tracer
+		skipPaths         map[string]bool
+		skipPathRegexps   []*regexp.Regexp
+		filter            func(c *gin.Context) bool
+		startHook         func(span opentracing.Span, c *gin.Context)
+		finishHook        func(span opentracing.Span, c *gin.Context)
+		traceIDHeader     string
+		baggageTags       []string
+		capture           *httpCapture
+	}
+)
+
+// WithGinOperationNameFunc 设置 span 的 operation 名称生成函数，默认为 "请求方法 路由模板"，例如 "GET /users/:id"
+func WithGinOperationNameFunc(f func(c *gin.Context) string) GinOption {
+	return func(opts *ginOptions) {
+		if f != nil {
+			opts.operationNameFunc = f
+		}
+	}
+}
+
+// WithGinClientErrors 设置 4xx 响应是否标记为错误，默认只有 5xx 标记为错误
+func WithGinClientErrors(enable bool) GinOption {
+	return func(opts *ginOptions) {
+		opts.clientErrors = enable
+	}
+}
+
+// WithGinTracer 设置 使用的追踪器，默认使用 opentracing.GlobalTracer()
+func WithGinTracer(tracer opentracing.Tracer) GinOption {
+	return func(opts *ginOptions) {
+		opts.tracer = tracer
+	}
+}
+
+// WithGinSkipPaths 设置 不追踪的请求路径，按 URL.Path 完全匹配，例如 "/healthz"、"/metrics"
+func WithGinSkipPaths(paths ...string) GinOption {
+	return func(opts *ginOptions) {
+		for _, path := range paths {
+			opts.skipPaths[path] = true
+		}
+	}
+}
+
+// WithGinSkipPathRegexps 设置 不追踪的请求路径正则，URL.Path 匹配任一正则时不追踪
+func WithGinSkipPathRegexps(regexps ...*regexp.Regexp) GinOption {
+	return func(opts *ginOptions) {
+		opts.skipPathRegexps = append(opts.skipPathRegexps, regexps...)
+	}
+}
+
+// WithGinFilter 设置 过滤函数，返回 false 时不追踪该请求
+func WithGinFilter(filter func(c *gin.Context) bool) GinOption {
+	return func(opts *ginOptions) {
+		opts.filter = filter
+	}
+}
+
+// WithGinBaggageTags 设置 需要提升为 span tag 的 baggage key，不设置时使用 SetBaggageTags 的全局设置
+func WithGinBaggageTags(keys ...string) GinOption {
+	return func(opts *ginOptions) {
+		opts.baggageTags = append([]string(nil), keys...)
+	}
+}
+
+// WithGinStartSpanHook 设置 span 创建后的回调，可以根据请求添加自定义 tag，在 handler 执行前调用
+func WithGinStartSpanHook(hook func(span opentracing.Span, c *gin.Context)) GinOption {
+	return func(opts *ginOptions) {
+		opts.startHook = hook
+	}
+}
+
+// WithGinFinishSpanHook 设置 span 结束前的回调，可以根据响应添加自定义 tag，在 handler 执行后调用，handler panic 时不调用
+func WithGinFinishSpanHook(hook func(span opentracing.Span, c *gin.Context)) GinOption {
+	return func(opts *ginOptions) {
+		opts.finishHook = hook
+	}
+}
+
+// WithGinTraceIDHeader 设置 在响应头中返回 trace id，header 为空时使用 X-Trace-Id
+func WithGinTraceIDHeader(header string) GinOption {
+	return func(opts *ginOptions) {
+		if header == "" {
+			header = DefaultTraceIDHeader
+		}
+		opts.traceIDHeader = header
+	}
+}
+
 // SetGinTraceMid 创建链路追踪中间件
-func SetGinTraceMid() gin.HandlerFunc {
+func SetGinTraceMid(opts ...GinOption) gin.HandlerFunc {
+	options := &ginOptions{
+		operationNameFunc: ginOperationName,
+		skipPaths:         make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return func(c *gin.Context) {
-		globalTracer := opentracing.GlobalTracer()
-		if globalTracer == nil {
+		tracer := options.tracer
+		if tracer == nil {
+			tracer = opentracing.GlobalTracer()
+		}
+		if tracer == nil || options.skip(c) {
 			c.Next()
 			return
 		}
 
-		operationName := c.Request.URL.Host + "/" + c.Request.URL.Path
-		var parentSpan opentracing.Span
-		spCtx, err := globalTracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(c.Request.Header))
-		if err != nil {
-			// 如果请求没有带 tracer id 则生成新的 span
-			parentSpan = globalTracer.StartSpan(operationName)
-			defer parentSpan.Finish()
-		} else {
-			// 如果请求有带 tracer id 从父 span 生成子 span
-			parentSpan = opentracing.StartSpan(
-				operationName,
-				opentracing.ChildOf(spCtx),
-				opentracing.Tag{Key: string(ext.Component), Value: "Gin-Http"},
-				opentracing.Tag{Key: "path", Value: c.Request.URL.Path},
-				opentracing.Tag{Key: "host", Value: c.Request.URL.Host},
-				opentracing.Tag{Key: "method", Value: c.Request.Method},
-				ext.SpanKindRPCServer,
-			)
-			defer parentSpan.Finish()
+		startOpts := []opentracing.StartSpanOption{
+			opentracing.Tag{Key: string(ext.Component), Value: ginComponent},
+			ext.SpanKindRPCServer,
+		}
+		// 如果请求有带 tracer id 从父 span 生成子 span，否则生成新的 span
+		spCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(c.Request.Header))
+		if err == nil {
+			startOpts = append(startOpts, opentracing.ChildOf(spCtx))
+		}
+		parentSpan := tracer.StartSpan(options.operationNameFunc(c), startOpts...)
+		defer parentSpan.Finish()
+		// 记录 panic 后继续抛出，由 gin.Recovery 等外层中间件处理
+		defer func() {
+			if r := recover(); r != nil {
+				LogPanic(parentSpan, r)
+				SetHTTPRequestTags(parentSpan, c.Request, c.FullPath(), c.ClientIP())
+				panic(r)
+			}
+		}()
+
+		PromoteBaggageTags(parentSpan, options.baggageTags...)
+		if options.startHook != nil {
+			options.startHook(parentSpan, c)
+		}
+		// 在 handler 写入响应前设置，否则响应头不会生效
+		if options.traceIDHeader != "" {
+			if traceID := spanTraceID(parentSpan); traceID != "" {
+				c.Header(options.traceIDHeader, traceID)
+			}
 		}
 		c.Request = c.Request.WithContext(opentracing.ContextWithSpan(c.Request.Context(), parentSpan))
+		var captureWriter *captureResponseWriter
+		if options.capture.sampled(parentSpan) {
+			options.capture.captureRequest(parentSpan, c.Request)
+			captureWriter = newCaptureResponseWriter(c.Writer, options.capture.maxBodySize)
+			c.Writer = captureWriter
+		}
 		c.Set(_HTTP_FRAME_CTX_KEY, _HTTP_FRAME_GIN)
 		c.Next()
+
+		SetHTTPRequestTags(parentSpan, c.Request, c.FullPath(), c.ClientIP())
+		SetHTTPStatusTags(parentSpan, c.Writer.Status(), options.clientErrors)
+		logGinErrors(parentSpan, c.Errors)
+		if captureWriter != nil {
+			options.capture.captureResponse(parentSpan, captureWriter)
+			c.Writer = captureWriter.ResponseWriter
+		}
+		if options.finishHook != nil {
+			options.finishHook(parentSpan, c)
+		}
+	}
+}
+
+// skip 判断请求是否不需要追踪
+func (o *ginOptions) skip(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	if o.skipPaths[path] {
+		return true
+	}
+	for _, re := range o.skipPathRegexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return o.filter != nil && !o.filter(c)
+}
+
+// ginOperationName 使用路由模板命名，避免路径参数导致 operation 数量膨胀；未匹配到路由时不带路径
+func ginOperationName(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return c.Request.Method + " " + route
+	}
+	return c.Request.Method + " route not found"
+}
+
+// logGinErrors 把 handler 通过 c.Error 记录的错误写入 span 日志
+func logGinErrors(span opentracing.Span, errs []*gin.Error) {
+	for _, err := range errs {
+		fields := []log.Field{
+			log.String("event", "error"),
+			log.String("error.kind", ginErrorKind(err.Type)),
+			log.String("message", err.Error()),
+		}
+		if err.Meta != nil {
+			fields = append(fields, log.Object("meta", err.Meta))
+		}
+		span.LogFields(fields...)
+	}
+}
+
+func ginErrorKind(t gin.ErrorType) string {
+	switch {
+	case t == gin.ErrorTypeAny:
+		return "any"
+	case t&gin.ErrorTypeBind != 0:
+		return "bind"
+	case t&gin.ErrorTypeRender != 0:
+		return "render"
+	case t&gin.ErrorTypePublic != 0:
+		return "public"
+	case t&gin.ErrorTypePrivate != 0:
+		return "private"
 	}
+	return "other"
 }
@@ -0,0 +1,123 @@
+package tracemid_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	tracemid "github.com/qxiong522/go-jaeger-trace/mid"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+func TestGinTraceMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewRecorder(t)
+
+	engine := gin.New()
+	engine.Use(tracemid.SetGinTraceMid(tracemid.WithGinTraceIDHeader("")))
+	engine.GET("/users/:id", func(c *gin.Context) {
+		span, _ := opentracing.StartSpanFromContext(c.Request.Context(), "load user")
+		span.Finish()
+		c.String(http.StatusInternalServerError, "boom")
+	})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	client := &http.Client{Transport: tracemid.Transport(nil)}
+	resp, e := client.Get(server.URL + "/users/1?token=secret")
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	recorder.WaitForSpans(3, time.Second)
+	recorder.AssertSpanCount(t, 3)
+	serverSpan := recorder.AssertSpan(t, "GET /users/:id",
+		ext.SpanKindRPCServer,
+		opentracing.Tag{Key: string(ext.HTTPStatusCode), Value: http.StatusInternalServerError},
+		opentracing.Tag{Key: string(ext.Error), Value: true},
+		opentracing.Tag{Key: "http.route", Value: "/users/:id"},
+		opentracing.Tag{Key: string(ext.HTTPUrl), Value: "/users/1"},
+	)
+	clientSpan := recorder.AssertSpan(t, "HTTP GET",
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: string(ext.HTTPStatusCode), Value: http.StatusInternalServerError},
+		opentracing.Tag{Key: string(ext.HTTPUrl), Value: server.URL + "/users/1"},
+	)
+	childSpan := recorder.AssertSpan(t, "load user")
+	tracetest.AssertParentChild(t, clientSpan, serverSpan)
+	tracetest.AssertParentChild(t, serverSpan, childSpan)
+	if serverSpan != nil && resp.Header.Get(tracemid.DefaultTraceIDHeader) != serverSpan.SpanContext().TraceID().String() {
+		t.Errorf("trace id header = %q", resp.Header.Get(tracemid.DefaultTraceIDHeader))
+	}
+}
+
+func TestGinTraceMidSkipPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewRecorder(t)
+
+	engine := gin.New()
+	engine.Use(tracemid.SetGinTraceMid(tracemid.WithGinSkipPaths("/healthz")))
+	engine.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	recorder.AssertNoSpan(t, "GET /healthz")
+	recorder.AssertSpan(t, "GET route not found",
+		opentracing.Tag{Key: string(ext.HTTPStatusCode), Value: http.StatusNotFound},
+	)
+}
+
+func TestTransportTracer(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Uber-Trace-Id") == "" {
+			t.Errorf("trace context not injected: %v", req.Header)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: tracemid.Transport(nil, tracemid.WithHTTPTracer(recorder.Tracer))}
+	resp, e := client.Get(server.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+
+	recorder.AssertSpan(t, "HTTP GET", ext.SpanKindRPCClient)
+}
+
+func TestGinBaggageTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewRecorder(t)
+	tracemid.SetBaggageTags("tenant")
+	defer tracemid.SetBaggageTags()
+
+	engine := gin.New()
+	engine.Use(tracemid.SetGinTraceMid(tracemid.WithGinBaggageTags("user")))
+	engine.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Uberctx-User", "alice")
+	req.Header.Set("Uberctx-Tenant", "acme")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := recorder.AssertSpan(t, "GET /", opentracing.Tag{Key: "user", Value: "alice"})
+	if span != nil {
+		if _, ok := span.Tags()["tenant"]; ok {
+			t.Errorf("global baggage tag promoted: %v", span.Tags())
+		}
+	}
+}
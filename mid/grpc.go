@@ -2,20 +2,34 @@ package tracemid
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	tracerLog "github.com/opentracing/opentracing-go/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	grpcClientComponent = "gRPC_Client"
 	grpcServerComponent = "gRPC_Server"
+
+	tagRPCSystem      = "rpc.system"
+	tagRPCService     = "rpc.service"
+	tagRPCMethod      = "rpc.method"
+	tagGRPCStatusCode = "rpc.grpc.status_code"
+	tagPeerAddress    = "peer.address"
 )
 
+// grpcErrorCodes 标记为错误的状态码，类型为 map[codes.Code]bool，未设置时所有非 OK 状态码均为错误
+var grpcErrorCodes atomic.Value
+
 // MDReaderWriter metadata不存在ForeachKey成员方法，这里需要重新声明实现
 type MDReaderWriter struct {
 	metadata.MD
@@ -40,6 +54,44 @@ func (c MDReaderWriter) Set(key, val string) {
 
 // GRPCServerTracerInterceptor GRPC 服务端拦截器
 func GRPCServerTracerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	parentSpan, ctx := startGRPCServerSpan(ctx, info.FullMethod)
+	defer parentSpan.Finish()
+	resp, err = handler(ctx, req)
+	setGRPCStatus(parentSpan, err)
+	return resp, err
+}
+
+// GRPCClientTracerInterceptor GRPC 客户端拦截器
+func GRPCClientTracerInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+	span, newCtx := startGRPCClientSpan(ctx, method)
+	defer span.Finish()
+
+	var p peer.Peer
+	err := invoker(newCtx, method, req, reply, cc, append(opts[:len(opts):len(opts)], grpc.Peer(&p))...)
+	setGRPCPeer(span, &p)
+	setGRPCStatus(span, err)
+	return err
+}
+
+/*
+SetGRPCErrorCodes 设置 gRPC 拦截器中标记为错误的状态码，例如只把 Internal、Unavailable 等服务端问题标记为错误
+其他非 OK 状态码仍然记录 rpc.grpc.status_code 和状态信息，但不设置 error tag
+不传参数时恢复默认，所有非 OK 状态码均为错误
+Args:
+ - errorCodes: 标记为错误的状态码
+*/
+func SetGRPCErrorCodes(errorCodes ...codes.Code) {
+	set := make(map[codes.Code]bool, len(errorCodes))
+	for _, code := range errorCodes {
+		set[code] = true
+	}
+	grpcErrorCodes.Store(set)
+}
+
+// startGRPCServerSpan 从 metadata 中解析父 span 并创建服务端 span，返回携带 span 的 context
+func startGRPCServerSpan(ctx context.Context, fullMethod string) (opentracing.Span, context.Context) {
 	// 从 context 中获取 metadata
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -49,39 +101,33 @@ func GRPCServerTracerInterceptor(ctx context.Context, req interface{}, info *grp
 		md = md.Copy()
 	}
 
-	var parentSpan opentracing.Span
-	carrier := MDReaderWriter{md}
-	//tracer := opentracing.GlobalTracer()
-	// 解析出 span
-	spanContext, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier)
-	if err != nil {
-		span := opentracing.GlobalTracer().StartSpan("grpc:" + info.FullMethod)
-		defer span.Finish()
-	} else {
-		// 如果请求有带 trace id 则生成
-		parentSpan = opentracing.StartSpan(
-			"grpc:"+info.FullMethod,
-			opentracing.ChildOf(spanContext),
-			opentracing.Tag{Key: string(ext.Component), Value: grpcServerComponent},
-			ext.SpanKindRPCServer,
-		)
-		defer parentSpan.Finish()
-	}
-	ctx = opentracing.ContextWithSpan(ctx, parentSpan)
-	return handler(ctx, req)
+	startOpts := []opentracing.StartSpanOption{
+		opentracing.Tag{Key: string(ext.Component), Value: grpcServerComponent},
+		ext.SpanKindRPCServer,
+	}
+	// 如果请求有带 trace id 则从父 span 生成子 span
+	spanContext, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, MDReaderWriter{md})
+	if err == nil {
+		startOpts = append(startOpts, opentracing.ChildOf(spanContext))
+	}
+	parentSpan := opentracing.GlobalTracer().StartSpan("grpc:"+fullMethod, startOpts...)
+	setGRPCMethodTags(parentSpan, fullMethod)
+	if p, ok := peer.FromContext(ctx); ok {
+		setGRPCPeer(parentSpan, p)
+	}
+	PromoteBaggageTags(parentSpan)
+	return parentSpan, opentracing.ContextWithSpan(ctx, parentSpan)
 }
 
-// GRPCClientTracerInterceptor GRPC 客户端拦截器
-func GRPCClientTracerInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
-	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-
+// startGRPCClientSpan 创建客户端 span 并注入到 outgoing metadata，注入失败时仍然发起调用
+// peer.address 在调用结束后由 setGRPCPeer 设置
+func startGRPCClientSpan(ctx context.Context, method string) (opentracing.Span, context.Context) {
 	span, _ := opentracing.StartSpanFromContext(getContext(ctx), "grpc:"+method,
 		opentracing.Tag{Key: string(ext.Component), Value: grpcClientComponent},
 		opentracing.Tag{Key: "method", Value: method},
 		ext.SpanKindRPCClient,
 	)
-
-	defer span.Finish()
+	setGRPCMethodTags(span, method)
 
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if !ok {
@@ -92,13 +138,66 @@ func GRPCClientTracerInterceptor(ctx context.Context, method string, req, reply
 	injectErr := opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, MDReaderWriter{md})
 	if injectErr != nil {
 		span.LogFields(tracerLog.String("inject_err", injectErr.Error()))
-		return nil
+		return span, ctx
 	}
+	return span, metadata.NewOutgoingContext(ctx, md)
+}
 
-	newCtx := metadata.NewOutgoingContext(ctx, md)
-	err := invoker(newCtx, method, req, reply, cc, opts...)
-	if err != nil {
-		span.LogFields(tracerLog.String("call_error", err.Error()))
+// setGRPCPeer 记录对端的实际地址，客户端通过 grpc.Peer 在调用结束后取得，而不是 ClientConn 的拨号目标
+func setGRPCPeer(span opentracing.Span, p *peer.Peer) {
+	if p.Addr != nil {
+		span.SetTag(tagPeerAddress, p.Addr.String())
 	}
-	return err
+}
+
+// setGRPCMethodTags 把 "/package.Service/Method" 拆分为 rpc.service 和 rpc.method
+func setGRPCMethodTags(span opentracing.Span, fullMethod string) {
+	span.SetTag(tagRPCSystem, "grpc")
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		span.SetTag(tagRPCService, name[:i])
+		name = name[i+1:]
+	}
+	span.SetTag(tagRPCMethod, name)
+}
+
+// setGRPCStatus 设置状态码，非 OK 时记录状态信息和 details，状态码属于错误码时标记为错误
+func setGRPCStatus(span opentracing.Span, err error) {
+	if err == nil {
+		span.SetTag(tagGRPCStatusCode, uint32(codes.OK))
+		return
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		// context 取消或超时转换为对应的状态码，其他错误为 Unknown
+		st = status.FromContextError(err)
+	}
+	code := st.Code()
+	span.SetTag(tagGRPCStatusCode, uint32(code))
+	if code == codes.OK {
+		return
+	}
+
+	event := "grpc.status"
+	if isGRPCErrorCode(code) {
+		event = "error"
+		ext.Error.Set(span, true)
+	}
+	fields := []tracerLog.Field{
+		tracerLog.String("event", event),
+		tracerLog.String("grpc.status", code.String()),
+		tracerLog.String("message", st.Message()),
+	}
+	if details := st.Details(); len(details) > 0 {
+		fields = append(fields, tracerLog.String("grpc.status_details", fmt.Sprintf("%v", details)))
+	}
+	span.LogFields(fields...)
+}
+
+func isGRPCErrorCode(code codes.Code) bool {
+	set, _ := grpcErrorCodes.Load().(map[codes.Code]bool)
+	if len(set) == 0 {
+		return code != codes.OK
+	}
+	return set[code]
 }
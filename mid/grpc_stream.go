@@ -0,0 +1,236 @@
+package tracemid
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	tracerLog "github.com/opentracing/opentracing-go/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	grpcMessageSent     = "SENT"
+	grpcMessageReceived = "RECEIVED"
+
+	tagGRPCMessagesSent     = "rpc.grpc.messages_sent"
+	tagGRPCMessagesReceived = "rpc.grpc.messages_received"
+
+	defaultGRPCMessageLogLimit = 100
+)
+
+// grpcMessageLogLimit 每个流的每个方向最多记录的消息日志数量
+var grpcMessageLogLimit int64 = defaultGRPCMessageLogLimit
+
+/*
+SetGRPCMessageLogLimit 设置 gRPC 流拦截器中每个方向最多记录多少条消息日志，默认 100
+超过后不再记录日志，只在 span 结束时通过 rpc.grpc.messages_sent、rpc.grpc.messages_received 记录消息总数，
+避免长时间的流让 span 无限增长
+Args:
+ - limit: 每个方向的日志数量上限，0 表示不记录消息日志
+*/
+func SetGRPCMessageLogLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	atomic.StoreInt64(&grpcMessageLogLimit, int64(limit))
+}
+
+type (
+	// tracedServerStream 让 handler 通过 Context() 取得携带 span 的 context，并记录收发的消息
+	tracedServerStream struct {
+		grpc.ServerStream
+		ctx      context.Context
+		span     opentracing.Span
+		sent     int64
+		received int64
+	}
+
+	// tracedClientStream 记录收发的消息，收到 EOF、出错或 context 取消时结束 span
+	// mu 保证 span 结束后不再记录消息日志；peer 由 grpc 在调用结束时填充
+	tracedClientStream struct {
+		grpc.ClientStream
+		span          opentracing.Span
+		peer          *peer.Peer
+		serverStreams bool
+		sent          int64
+		received      int64
+		mu            sync.Mutex
+		finishOnce    sync.Once
+		finished      chan struct{}
+	}
+)
+
+// GRPCStreamServerTracerInterceptor GRPC 服务端流拦截器，handler 返回时结束 span
+func GRPCStreamServerTracerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	span, ctx := startGRPCServerSpan(ss.Context(), info.FullMethod)
+	defer span.Finish()
+
+	stream := &tracedServerStream{ServerStream: ss, ctx: ctx, span: span}
+	err := handler(srv, stream)
+	setGRPCMessageTags(span, atomic.LoadInt64(&stream.sent), atomic.LoadInt64(&stream.received))
+	setGRPCStatus(span, err)
+	return err
+}
+
+// GRPCStreamClientTracerInterceptor GRPC 客户端流拦截器，收到 EOF、出错或 context 取消时结束 span
+// 与 grpc 自身的要求一致，调用方需要一直 RecvMsg 直到返回 io.EOF 或错误，或者取消 ctx，否则 span 不会结束
+func GRPCStreamClientTracerInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+	span, newCtx := startGRPCClientSpan(ctx, method)
+	p := &peer.Peer{}
+	cs, err := streamer(newCtx, desc, cc, method, append(opts[:len(opts):len(opts)], grpc.Peer(p))...)
+	if err != nil {
+		setGRPCStatus(span, err)
+		span.Finish()
+		return nil, err
+	}
+
+	stream := &tracedClientStream{
+		ClientStream:  cs,
+		span:          span,
+		peer:          p,
+		serverStreams: desc.ServerStreams,
+		finished:      make(chan struct{}),
+	}
+	// ctx 不会取消时（例如 context.Background()）无需监听，避免流未读完时 goroutine 泄漏
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-stream.finished:
+			case <-ctx.Done():
+				stream.finish(ctx.Err(), nil)
+			}
+		}()
+	}
+	return stream, nil
+}
+
+// Context 实现 grpc.ServerStream
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg 实现 grpc.ServerStream
+func (s *tracedServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		logGRPCMessage(s.span, grpcMessageSent, atomic.AddInt64(&s.sent, 1), m)
+	}
+	return err
+}
+
+// RecvMsg 实现 grpc.ServerStream
+func (s *tracedServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		logGRPCMessage(s.span, grpcMessageReceived, atomic.AddInt64(&s.received, 1), m)
+	}
+	return err
+}
+
+// Header 实现 grpc.ClientStream
+func (s *tracedClientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err, nil)
+	}
+	return md, err
+}
+
+// CloseSend 实现 grpc.ClientStream
+func (s *tracedClientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.finish(err, nil)
+	}
+	return err
+}
+
+// SendMsg 实现 grpc.ClientStream
+func (s *tracedClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil {
+		s.finish(err, nil)
+		return err
+	}
+	s.logMessage(grpcMessageSent, atomic.AddInt64(&s.sent, 1), m)
+	return nil
+}
+
+// RecvMsg 实现 grpc.ClientStream，非服务端流的调用收到一条响应后即结束
+// 这些情况下 grpc 在 RecvMsg 返回前已经结束调用并填充 peer，可以读取
+func (s *tracedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.finish(nil, s.peer)
+		return err
+	}
+	if err != nil {
+		s.finish(err, s.peer)
+		return err
+	}
+	s.logMessage(grpcMessageReceived, atomic.AddInt64(&s.received, 1), m)
+	if !s.serverStreams {
+		s.finish(nil, s.peer)
+	}
+	return nil
+}
+
+// logMessage span 已经结束（例如 ctx 被取消）时不再记录
+func (s *tracedClientStream) logMessage(messageType string, id int64, m interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.finished:
+		return
+	default:
+	}
+	logGRPCMessage(s.span, messageType, id, m)
+}
+
+// finish 结束 span，p 为 nil 时不记录 peer.address，例如 ctx 取消时 grpc 可能仍在填充 peer
+func (s *tracedClientStream) finish(err error, p *peer.Peer) {
+	s.finishOnce.Do(func() {
+		s.mu.Lock()
+		if p != nil {
+			setGRPCPeer(s.span, p)
+		}
+		setGRPCMessageTags(s.span, atomic.LoadInt64(&s.sent), atomic.LoadInt64(&s.received))
+		setGRPCStatus(s.span, err)
+		close(s.finished)
+		s.mu.Unlock()
+		s.span.Finish()
+	})
+}
+
+// logGRPCMessage 把收发的消息记录为 span 日志，protobuf 消息同时记录大小，超过 SetGRPCMessageLogLimit 的不再记录
+func logGRPCMessage(span opentracing.Span, messageType string, id int64, m interface{}) {
+	if id > atomic.LoadInt64(&grpcMessageLogLimit) {
+		return
+	}
+	fields := []tracerLog.Field{
+		tracerLog.String("event", "message"),
+		tracerLog.String("message.type", messageType),
+		tracerLog.Int64("message.id", id),
+	}
+	if msg, ok := m.(proto.Message); ok {
+		fields = append(fields, tracerLog.Int("message.uncompressed_size", proto.Size(msg)))
+	}
+	span.LogFields(fields...)
+}
+
+// setGRPCMessageTags 记录流收发的消息总数
+func setGRPCMessageTags(span opentracing.Span, sent, received int64) {
+	span.SetTag(tagGRPCMessagesSent, sent)
+	span.SetTag(tagGRPCMessagesReceived, received)
+}
@@ -0,0 +1,167 @@
+package tracemid_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	tracemid "github.com/qxiong522/go-jaeger-trace/mid"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+const (
+	healthCheckMethod = "/grpc.health.v1.Health/Check"
+	healthWatchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// newHealthClient 启动带追踪拦截器的 health 服务，返回同样带拦截器的客户端
+func newHealthClient(t *testing.T) healthpb.HealthClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(tracemid.GRPCServerTracerInterceptor),
+		grpc.StreamInterceptor(tracemid.GRPCStreamServerTracerInterceptor),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("ok", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, e := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(tracemid.GRPCClientTracerInterceptor),
+		grpc.WithStreamInterceptor(tracemid.GRPCStreamClientTracerInterceptor),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		server.Stop()
+	})
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestGRPCUnaryInterceptors(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+	client := newHealthClient(t)
+
+	if _, e := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "ok"}); e != nil {
+		t.Fatal(e)
+	}
+	recorder.WaitForSpans(2, time.Second)
+	serverSpan := recorder.AssertSpan(t, "grpc:"+healthCheckMethod,
+		ext.SpanKindRPCServer,
+		opentracing.Tag{Key: "rpc.system", Value: "grpc"},
+		opentracing.Tag{Key: "rpc.service", Value: "grpc.health.v1.Health"},
+		opentracing.Tag{Key: "rpc.method", Value: "Check"},
+		opentracing.Tag{Key: "rpc.grpc.status_code", Value: uint32(codes.OK)},
+	)
+	// peer.address 为实际连接的地址，而不是拨号目标 bufnet
+	clientSpan := recorder.AssertSpan(t, "grpc:"+healthCheckMethod,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: "rpc.grpc.status_code", Value: uint32(codes.OK)},
+		opentracing.Tag{Key: "peer.address", Value: "bufconn"},
+	)
+	tracetest.AssertParentChild(t, clientSpan, serverSpan)
+
+	recorder.Reset()
+	if _, e := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"}); e == nil {
+		t.Fatal("expected NotFound error")
+	}
+	recorder.WaitForSpans(2, time.Second)
+	recorder.AssertSpan(t, "grpc:"+healthCheckMethod,
+		ext.SpanKindRPCServer,
+		opentracing.Tag{Key: "rpc.grpc.status_code", Value: uint32(codes.NotFound)},
+		opentracing.Tag{Key: string(ext.Error), Value: true},
+	)
+	recorder.AssertSpan(t, "grpc:"+healthCheckMethod,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: "rpc.grpc.status_code", Value: uint32(codes.NotFound)},
+		opentracing.Tag{Key: string(ext.Error), Value: true},
+	)
+}
+
+func TestGRPCStreamInterceptors(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+	client := newHealthClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, e := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "ok"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	resp, e := stream.Recv()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v", resp.GetStatus())
+	}
+	// Watch 不会主动结束，取消 ctx 后两端的 span 都应结束
+	cancel()
+
+	recorder.WaitForSpans(2, time.Second)
+	clientSpan := recorder.AssertSpan(t, "grpc:"+healthWatchMethod,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: "rpc.grpc.status_code", Value: uint32(codes.Canceled)},
+	)
+	serverSpan := recorder.AssertSpan(t, "grpc:"+healthWatchMethod,
+		ext.SpanKindRPCServer,
+		opentracing.Tag{Key: "rpc.method", Value: "Watch"},
+	)
+	tracetest.AssertParentChild(t, clientSpan, serverSpan)
+	if clientSpan != nil && len(clientSpan.Logs()) == 0 {
+		t.Errorf("client span has no message logs")
+	}
+}
+
+func TestGRPCMessageLogLimit(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+	client := newHealthClient(t)
+	tracemid.SetGRPCMessageLogLimit(0)
+	t.Cleanup(func() { tracemid.SetGRPCMessageLogLimit(100) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, e := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "ok"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := stream.Recv(); e != nil {
+		t.Fatal(e)
+	}
+	cancel()
+
+	recorder.WaitForSpans(2, time.Second)
+	// 不记录消息日志，只记录消息数量
+	for _, kind := range []opentracing.Tag{ext.SpanKindRPCClient, ext.SpanKindRPCServer} {
+		span := recorder.AssertSpan(t, "grpc:"+healthWatchMethod, kind,
+			opentracing.Tag{Key: "rpc.grpc.messages_sent", Value: int64(1)},
+			opentracing.Tag{Key: "rpc.grpc.messages_received", Value: int64(1)},
+		)
+		if span == nil {
+			continue
+		}
+		for _, l := range span.Logs() {
+			for _, f := range l.Fields {
+				if f.Key() == "event" && f.Value() == "message" {
+					t.Errorf("%v span logged message", kind.Value)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package tracemid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	httpComponent = "Net-Http"
+
+	tagHTTPRoute     = "http.route"
+	tagHTTPUserAgent = "http.user_agent"
+	tagPeerIP        = "peer.ip"
+)
+
+type (
+	HTTPOption func(opts *httpOptions)
+
+	httpOptions struct {
+		operationNameFunc func(req *http.Request) string
+		clientErrors      bool
+		tracer            opentracing.Tracer
+		skipPaths         map[string]bool
+		filter            func(req *http.Request) bool
+		traceIDHeader     string
+		baggageTags       []string
+	}
+
+	// statusResponseWriter 记录响应状态码
+	statusResponseWriter struct {
+		http.ResponseWriter
+		status      int
+		wroteHeader bool
+	}
+
+	// flushResponseWriter 原 ResponseWriter 实现 http.Flusher 时使用
+	flushResponseWriter struct {
+		*statusResponseWriter
+	}
+
+	// hijackResponseWriter 原 ResponseWriter 实现 http.Hijacker 时使用
+	hijackResponseWriter struct {
+		*statusResponseWriter
+	}
+
+	// flushHijackResponseWriter 原 ResponseWriter 同时实现 http.Flusher 和 http.Hijacker 时使用
+	flushHijackResponseWriter struct {
+		*statusResponseWriter
+	}
+
+	// transport 为请求创建客户端 span 并注入到请求头，响应 body 关闭时结束 span
+	transport struct {
+		base    http.RoundTripper
+		options *httpOptions
+	}
+
+	spanBody struct {
+		io.ReadCloser
+		span opentracing.Span
+		once sync.Once
+	}
+
+	// spanReadWriteBody 101 Switching Protocols 的响应 body 可写，需要保留 io.Writer
+	spanReadWriteBody struct {
+		*spanBody
+		io.Writer
+	}
+)
+
+// WithHTTPOperationNameFunc 设置 span 的 operation 名称生成函数，默认为 "HTTP 请求方法"，需要区分接口时可返回路由模板，不要直接使用带参数的路径
+func WithHTTPOperationNameFunc(f func(req *http.Request) string) HTTPOption {
+	return func(opts *httpOptions) {
+		if f != nil {
+			opts.operationNameFunc = f
+		}
+	}
+}
+
+// WithHTTPClientErrors 设置 4xx 响应是否标记为错误，默认只有 5xx 标记为错误
+func WithHTTPClientErrors(enable bool) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.clientErrors = enable
+	}
+}
+
+// WithHTTPTracer 设置 使用的追踪器，默认使用 opentracing.GlobalTracer()
+func WithHTTPTracer(tracer opentracing.Tracer) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.tracer = tracer
+	}
+}
+
+// WithHTTPSkipPaths 设置 不追踪的请求路径，按 URL.Path 完全匹配，例如 "/healthz"、"/metrics"
+func WithHTTPSkipPaths(paths ...string) HTTPOption {
+	return func(opts *httpOptions) {
+		for _, path := range paths {
+			opts.skipPaths[path] = true
+		}
+	}
+}
+
+// WithHTTPFilter 设置 过滤函数，返回 false 时不追踪该请求
+func WithHTTPFilter(filter func(req *http.Request) bool) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.filter = filter
+	}
+}
+
+// WithHTTPTraceIDHeader 设置 在响应头中返回 trace id，header 为空时使用 X-Trace-Id
+func WithHTTPTraceIDHeader(header string) HTTPOption {
+	return func(opts *httpOptions) {
+		if header == "" {
+			header = DefaultTraceIDHeader
+		}
+		opts.traceIDHeader = header
+	}
+}
+
+// WithHTTPBaggageTags 设置 需要提升为 span tag 的 baggage key，只对 HTTPHandler 生效，不设置时使用 SetBaggageTags 的全局设置
+func WithHTTPBaggageTags(keys ...string) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.baggageTags = append([]string(nil), keys...)
+	}
+}
+
+// HTTPHandler 创建 net/http 链路追踪中间件，可用于 http.ServeMux、chi、gorilla/mux 等，tag 与 SetGinTraceMid 一致
+// operation 名称默认为 "HTTP 请求方法"，net/http 无法获取路由模板，按路径命名会导致 operation 数量不受控制
+func HTTPHandler(next http.Handler, opts ...HTTPOption) http.Handler {
+	options := &httpOptions{
+		operationNameFunc: httpOperationName,
+		skipPaths:         make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tracer := options.tracer
+		if tracer == nil {
+			tracer = opentracing.GlobalTracer()
+		}
+		if tracer == nil || options.skip(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		startOpts := []opentracing.StartSpanOption{
+			opentracing.Tag{Key: string(ext.Component), Value: httpComponent},
+			ext.SpanKindRPCServer,
+		}
+		// 如果请求有带 tracer id 从父 span 生成子 span，否则生成新的 span
+		spCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+		if err == nil {
+			startOpts = append(startOpts, opentracing.ChildOf(spCtx))
+		}
+		span := tracer.StartSpan(options.operationNameFunc(req), startOpts...)
+		defer span.Finish()
+		// 记录 panic 后继续抛出，由 net/http 或外层中间件处理
+		defer func() {
+			if r := recover(); r != nil {
+				LogPanic(span, r)
+				SetHTTPRequestTags(span, req, "", httpClientIP(req))
+				panic(r)
+			}
+		}()
+
+		PromoteBaggageTags(span, options.baggageTags...)
+		if options.traceIDHeader != "" {
+			if traceID := spanTraceID(span); traceID != "" {
+				w.Header().Set(options.traceIDHeader, traceID)
+			}
+		}
+		rw, sw := newStatusResponseWriter(w)
+		req = req.WithContext(opentracing.ContextWithSpan(req.Context(), span))
+		next.ServeHTTP(rw, req)
+
+		SetHTTPRequestTags(span, req, "", httpClientIP(req))
+		SetHTTPStatusTags(span, sw.status, options.clientErrors)
+	})
+}
+
+/*
+Transport 创建链路追踪 http.RoundTripper，为每个请求创建客户端 span，响应 body 关闭时结束 span
+父 span 从请求的 context 中获取，operation 名称默认为 "HTTP 请求方法"
+Args:
+ - base: 实际发送请求的 RoundTripper，为空时使用 http.DefaultTransport
+ - opts: 支持 WithHTTPTracer、WithHTTPOperationNameFunc、WithHTTPClientErrors、WithHTTPSkipPaths 和 WithHTTPFilter
+*/
+func Transport(base http.RoundTripper, opts ...HTTPOption) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	options := &httpOptions{
+		operationNameFunc: httpOperationName,
+		skipPaths:         make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &transport{base: base, options: options}
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tracer := t.options.tracer
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+	if tracer == nil || t.options.skip(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	startOpts := []opentracing.StartSpanOption{
+		opentracing.Tag{Key: string(ext.Component), Value: httpComponent},
+		ext.SpanKindRPCClient,
+	}
+	if parent := opentracing.SpanFromContext(req.Context()); parent != nil {
+		startOpts = append(startOpts, opentracing.ChildOf(parent.Context()))
+	}
+	span := tracer.StartSpan(t.options.operationNameFunc(req), startOpts...)
+	ext.HTTPMethod.Set(span, req.Method)
+	ext.HTTPUrl.Set(span, spanURL(req.URL))
+	ext.PeerHostname.Set(span, req.URL.Hostname())
+
+	// RoundTripper 不能修改原请求，复制后注入请求头
+	req = req.Clone(opentracing.ContextWithSpan(req.Context(), span))
+	if e := tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header)); e != nil {
+		span.LogFields(log.String("inject_err", e.Error()))
+	}
+
+	resp, e := t.base.RoundTrip(req)
+	if e != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("event", "error"), log.String("message", e.Error()))
+		span.Finish()
+		return resp, e
+	}
+	SetHTTPStatusTags(span, resp.StatusCode, t.options.clientErrors)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		span.Finish()
+		return resp, nil
+	}
+	body := &spanBody{ReadCloser: resp.Body, span: span}
+	if w, ok := resp.Body.(io.Writer); ok {
+		resp.Body = spanReadWriteBody{spanBody: body, Writer: w}
+	} else {
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// Close 关闭 body 并结束 span
+func (b *spanBody) Close() error {
+	e := b.ReadCloser.Close()
+	b.once.Do(b.span.Finish)
+	return e
+}
+
+// skip 判断请求是否不需要追踪
+func (o *httpOptions) skip(req *http.Request) bool {
+	if o.skipPaths[req.URL.Path] {
+		return true
+	}
+	return o.filter != nil && !o.filter(req)
+}
+
+func httpOperationName(req *http.Request) string {
+	return "HTTP " + req.Method
+}
+
+// httpClientIP 依次从 X-Forwarded-For、X-Real-Ip 和连接地址获取客户端 ip
+func httpClientIP(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		if ip := strings.TrimSpace(strings.Split(forwarded, ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	if ip := strings.TrimSpace(req.Header.Get("X-Real-Ip")); ip != "" {
+		return ip
+	}
+	if ip, _, e := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr)); e == nil {
+		return ip
+	}
+	return req.RemoteAddr
+}
+
+// SetHTTPRequestTags 设置服务端 span 的 HTTP 语义 tag，route 为空时不设置 http.route
+// http.url 不包含 query 和用户信息，避免记录 token、密码等敏感数据
+func SetHTTPRequestTags(span opentracing.Span, req *http.Request, route, peerIP string) {
+	ext.HTTPMethod.Set(span, req.Method)
+	ext.HTTPUrl.Set(span, spanURL(req.URL))
+	if route != "" {
+		span.SetTag(tagHTTPRoute, route)
+	}
+	span.SetTag(tagPeerIP, peerIP)
+	if ua := req.UserAgent(); ua != "" {
+		span.SetTag(tagHTTPUserAgent, ua)
+	}
+}
+
+// spanURL 去掉 query、fragment 和用户信息后的 url
+func spanURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	c.RawQuery = ""
+	c.ForceQuery = false
+	c.Fragment = ""
+	c.RawFragment = ""
+	return c.String()
+}
+
+// SetHTTPStatusTags 设置响应状态码，5xx 标记为错误，clientErrors 为 true 时 4xx 也标记为错误
+func SetHTTPStatusTags(span opentracing.Span, status int, clientErrors bool) {
+	ext.HTTPStatusCode.Set(span, uint16(status))
+	if status >= http.StatusInternalServerError || (clientErrors && status >= http.StatusBadRequest) {
+		ext.Error.Set(span, true)
+	}
+}
+
+// LogPanic 把 panic 和调用栈写入 span 日志并标记为错误
+func LogPanic(span opentracing.Span, r interface{}) {
+	ext.Error.Set(span, true)
+	span.LogFields(
+		log.String("event", "error"),
+		log.String("error.kind", "panic"),
+		log.String("message", fmt.Sprint(r)),
+		log.String("stack", string(debug.Stack())),
+	)
+}
+
+// newStatusResponseWriter 包装 w 记录响应状态码，只暴露 w 本身实现的 http.Flusher 和 http.Hijacker
+func newStatusResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *statusResponseWriter) {
+	sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	_, flusher := w.(http.Flusher)
+	_, hijacker := w.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return flushHijackResponseWriter{sw}, sw
+	case flusher:
+		return flushResponseWriter{sw}, sw
+	case hijacker:
+		return hijackResponseWriter{sw}, sw
+	}
+	return sw, sw
+}
+
+// WriteHeader 实现 http.ResponseWriter
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write 实现 http.ResponseWriter
+func (w *statusResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap 返回原 ResponseWriter，供 http.ResponseController 使用
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusResponseWriter) flush() {
+	w.wroteHeader = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *statusResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Flush 实现 http.Flusher
+func (w flushResponseWriter) Flush() {
+	w.flush()
+}
+
+// Hijack 实现 http.Hijacker，用于 websocket 等
+func (w hijackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// Flush 实现 http.Flusher
+func (w flushHijackResponseWriter) Flush() {
+	w.flush()
+}
+
+// Hijack 实现 http.Hijacker，用于 websocket 等
+func (w flushHijackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
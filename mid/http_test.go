@@ -0,0 +1,54 @@
+package tracemid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	tracemid "github.com/qxiong522/go-jaeger-trace/mid"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+// plainResponseWriter 只实现 http.ResponseWriter
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestHTTPHandler(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+
+	var flusher, hijacker bool
+	handler := tracemid.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		w.WriteHeader(http.StatusNotFound)
+	}), tracemid.WithHTTPTracer(recorder.Tracer))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	recorder.AssertSpan(t, "HTTP GET",
+		ext.SpanKindRPCServer,
+		opentracing.Tag{Key: string(ext.HTTPStatusCode), Value: http.StatusNotFound},
+	)
+	if !flusher || hijacker {
+		t.Errorf("httptest.ResponseRecorder wrapped as flusher=%v hijacker=%v", flusher, hijacker)
+	}
+
+	handler.ServeHTTP(plainResponseWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+	if flusher || hijacker {
+		t.Errorf("plain ResponseWriter wrapped as flusher=%v hijacker=%v", flusher, hijacker)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, e := http.Get(server.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+	if !flusher || !hijacker {
+		t.Errorf("server ResponseWriter wrapped as flusher=%v hijacker=%v", flusher, hijacker)
+	}
+}
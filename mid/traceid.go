@@ -0,0 +1,49 @@
+package tracemid
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTraceIDHeader 默认返回 trace id 的响应头
+const DefaultTraceIDHeader = "X-Trace-Id"
+
+// otelSpanContext trace.WithOTLPEndpoint 模式下桥接创建的 span context
+type otelSpanContext interface {
+	OTelSpanContext() oteltrace.SpanContext
+}
+
+// TraceIDFromContext 读取当前 span 的 trace id，ctx 中没有 span 时返回空字符串
+// ctx 可以是 *gin.Context、context.Context 或通过 RegisterContextResolver 注册的类型
+func TraceIDFromContext(ctx interface{}) string {
+	return spanTraceID(opentracing.SpanFromContext(getContext(ctx)))
+}
+
+func spanTraceID(span opentracing.Span) string {
+	if span == nil {
+		return ""
+	}
+	switch sc := span.Context().(type) {
+	case jaeger.SpanContext:
+		if sc.IsValid() {
+			return sc.TraceID().String()
+		}
+	case otelSpanContext:
+		if otelSC := sc.OTelSpanContext(); otelSC.IsValid() {
+			return otelSC.TraceID().String()
+		}
+	}
+	return ""
+}
+
+// spanSampled span 是否被采样，无法判断时视为已采样
+func spanSampled(span opentracing.Span) bool {
+	switch sc := span.Context().(type) {
+	case jaeger.SpanContext:
+		return sc.IsSampled()
+	case otelSpanContext:
+		return sc.OTelSpanContext().IsSampled()
+	}
+	return true
+}
@@ -0,0 +1,303 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// OTLP 传输协议
+const (
+	OTLPProtocolHTTPProtobuf = "http/protobuf"
+	OTLPProtocolGRPC         = "grpc"
+)
+
+// OTLP 压缩方式
+const (
+	OTLPCompressionNone = "none"
+	OTLPCompressionGzip = "gzip"
+)
+
+const (
+	otelInstrumentationName = "github.com/qxiong522/go-jaeger-trace"
+	otlpDefaultURLPath      = "/v1/traces"
+	otlpMaxRetries          = 3
+	otlpCloseTimeout        = 5 * time.Second
+	otlpStopTimeout         = time.Second
+)
+
+var errOTLPExporterStopped = errors.New("otlp exporter stopped")
+
+type (
+	// otelCloser 关闭 TracerProvider，推送队列中剩余的 span，未能推送的计入 Dropped
+	otelCloser struct {
+		provider *sdktrace.TracerProvider
+		exporter *otelStatsExporter
+		stats    *reporterStats
+	}
+
+	// otelStatsProcessor 统计结束的采样 span，需要注册在 BatchSpanProcessor 之前
+	otelStatsProcessor struct {
+		stats *reporterStats
+	}
+
+	// otelStatsExporter 统计推送成功和失败的 span，stop 后放弃正在进行的重试，之后的 span 直接计入 Dropped
+	otelStatsExporter struct {
+		sdktrace.SpanExporter
+		stats    *reporterStats
+		logger   jaeger.Logger
+		stopOnce sync.Once
+		stopped  chan struct{}
+		shutdown chan struct{}
+	}
+)
+
+// newOTelTracer 创建 OpenTelemetry SDK TracerProvider，通过 OpenTracing 桥接返回 opentracing.Tracer
+// span 经 BatchSpanProcessor 批量发送，队列大小和刷新间隔沿用 WithReporterQueueSize 和 WithBufferFlushInterval
+func (o *jaegerTracerOptions) newOTelTracer(serviceName string, stats *reporterStats, logger jaeger.Logger) (opentracing.Tracer, io.Closer, error) {
+	exporter, e := o.newOTLPExporter()
+	if e != nil {
+		return nil, nil, e
+	}
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(serviceName)}
+	for _, tag := range o.tags {
+		attrs = append(attrs, otelAttribute(tag.Key, tag.Value))
+	}
+	res, e := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if e != nil {
+		_ = exporter.Shutdown(context.Background())
+		return nil, nil, e
+	}
+
+	// 队列大小作为每批发送的数量，BatchSpanProcessor 的队列保留更大的缓冲
+	maxQueueSize := sdktrace.DefaultMaxQueueSize
+	if o.reporterQueueSize > maxQueueSize {
+		maxQueueSize = o.reporterQueueSize
+	}
+	batchOpts := []sdktrace.BatchSpanProcessorOption{
+		sdktrace.WithMaxQueueSize(maxQueueSize),
+		sdktrace.WithMaxExportBatchSize(o.reporterQueueSize),
+	}
+	if o.reporterBufferFlushInterval > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithBatchTimeout(o.reporterBufferFlushInterval))
+	}
+	statsExporter := &otelStatsExporter{
+		SpanExporter: exporter,
+		stats:        stats,
+		logger:       logger,
+		stopped:      make(chan struct{}),
+		shutdown:     make(chan struct{}),
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(o.newOTelSampler()),
+		sdktrace.WithSpanProcessor(otelStatsProcessor{stats: stats}),
+		sdktrace.WithBatcher(statsExporter, batchOpts...),
+	)
+	closer := &otelCloser{provider: provider, exporter: statsExporter, stats: stats}
+	return newOTelBridgeTracer(provider.Tracer(otelInstrumentationName)), closer, nil
+}
+
+// newOTelSampler 只支持 const 和 probabilistic，与 jaeger 一致，有父 span 时沿用父 span 的采样决定
+func (o *jaegerTracerOptions) newOTelSampler() sdktrace.Sampler {
+	if o.samplerType == jaeger.SamplerTypeProbabilistic {
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.samplerParam))
+	}
+	if o.samplerParam == 0 {
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	}
+	return sdktrace.ParentBased(sdktrace.AlwaysSample())
+}
+
+// newOTLPExporter 根据协议创建 OTLP/HTTP 或 OTLP/gRPC exporter
+// 失败重试从刷新间隔开始指数退避，最多重试 otlpMaxRetries 次；重试期间新的 span 在 BatchSpanProcessor 队列中等待
+func (o *jaegerTracerOptions) newOTLPExporter() (sdktrace.SpanExporter, error) {
+	interval := o.reporterBufferFlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	retry := otlptracehttp.RetryConfig{
+		Enabled:         true,
+		InitialInterval: interval,
+		MaxInterval:     interval << otlpMaxRetries,
+		MaxElapsedTime:  interval * (1<<(otlpMaxRetries+1) - 1),
+	}
+
+	if o.reporterOTLPProtocol == OTLPProtocolGRPC {
+		target, secure := o.reporterOTLPEndpoint, false
+		if strings.Contains(target, "://") {
+			u, e := url.Parse(target)
+			if e != nil {
+				return nil, e
+			}
+			target, secure = u.Host, u.Scheme == "https"
+		}
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(target),
+			otlptracegrpc.WithHeaders(o.reporterOTLPHeaders),
+			otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(retry)),
+		}
+		if !secure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if o.reporterOTLPCompression == OTLPCompressionGzip {
+			opts = append(opts, otlptracegrpc.WithCompressor(OTLPCompressionGzip))
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	}
+
+	u, e := url.Parse(o.reporterOTLPEndpoint)
+	if e != nil {
+		return nil, e
+	}
+	path := u.Path
+	if path == "" {
+		path = otlpDefaultURLPath
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithHeaders(o.reporterOTLPHeaders),
+		otlptracehttp.WithRetry(retry),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if o.reporterOTLPCompression == OTLPCompressionGzip {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+// validateOTLP OTLP 模式下 span 由 OpenTelemetry SDK 创建，只依赖 jaeger-client-go 的选项不能同时使用
+func (o *jaegerTracerOptions) validateOTLP() error {
+	if o.reporterOTLPEndpoint == "" {
+		return nil
+	}
+	switch o.samplerType {
+	case jaeger.SamplerTypeConst, jaeger.SamplerTypeProbabilistic:
+	default:
+		return fmt.Errorf("sampler type %s is not supported with otlp endpoint, expecting %s or %s",
+			o.samplerType, jaeger.SamplerTypeConst, jaeger.SamplerTypeProbabilistic)
+	}
+	for _, p := range o.propagations {
+		if p != PropagationW3C {
+			return fmt.Errorf("propagation %s is not supported with otlp endpoint, only %s is used", p, PropagationW3C)
+		}
+	}
+	switch {
+	case o.reporterCollectorEndpoint != "":
+		return errors.New("collector endpoint cannot be used together with otlp endpoint")
+	case o.reporterFilePath != "":
+		return errors.New("file reporter cannot be used together with otlp endpoint")
+	case len(o.reporters) > 0:
+		return errors.New("custom reporters cannot be used together with otlp endpoint")
+	case o.tailSamplingWindow > 0:
+		return errors.New("tail sampling cannot be used together with otlp endpoint")
+	case o.samplingStrategies != nil || o.samplingStrategiesFile != "" || o.samplerSamplingServerURL != "":
+		return errors.New("sampling strategies cannot be used together with otlp endpoint")
+	case o.rpcMetrics || o.metricsFactory != nil:
+		return errors.New("rpc metrics and metrics factory cannot be used together with otlp endpoint")
+	case o.headers != nil || o.baggageRestrictions != nil || o.throttler != nil:
+		return errors.New("jaeger headers, baggage restrictions and throttler cannot be used together with otlp endpoint")
+	}
+	return nil
+}
+
+// Close 实现 io.Closer，最多等待 otlpCloseTimeout，超时后放弃重试，剩余的 span 计入 Dropped
+func (c *otelCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpCloseTimeout)
+	defer cancel()
+
+	e := c.provider.Shutdown(ctx)
+	if e != nil {
+		// BatchSpanProcessor 仍在后台推送，停止后很快清空队列并关闭 exporter
+		c.exporter.stop()
+		select {
+		case <-c.exporter.shutdown:
+		case <-time.After(otlpStopTimeout):
+		}
+	}
+	// 队列已满被 BatchSpanProcessor 丢弃的 span 没有经过 exporter
+	stats := c.stats.snapshot()
+	if lost := stats.Finished - stats.Flushed - stats.Failed - stats.Dropped; lost > 0 {
+		atomic.AddInt64(&c.stats.dropped, lost)
+	}
+	return e
+}
+
+// OnStart 实现 sdktrace.SpanProcessor
+func (p otelStatsProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd 实现 sdktrace.SpanProcessor
+func (p otelStatsProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		atomic.AddInt64(&p.stats.finished, 1)
+	}
+}
+
+// Shutdown 实现 sdktrace.SpanProcessor
+func (p otelStatsProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+// ForceFlush 实现 sdktrace.SpanProcessor
+func (p otelStatsProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// ExportSpans 实现 sdktrace.SpanExporter，stop 时取消正在进行的发送和退避
+func (s *otelStatsExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	select {
+	case <-s.stopped:
+		atomic.AddInt64(&s.stats.dropped, int64(len(spans)))
+		return errOTLPExporterStopped
+	default:
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopped:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if e := s.SpanExporter.ExportSpans(ctx, spans); e != nil {
+		atomic.AddInt64(&s.stats.failed, int64(len(spans)))
+		if s.logger != nil {
+			s.logger.Error(fmt.Sprintf("send %d spans over otlp failed, err:%v", len(spans), e))
+		}
+		return e
+	}
+	atomic.AddInt64(&s.stats.flushed, int64(len(spans)))
+	return nil
+}
+
+// Shutdown 实现 sdktrace.SpanExporter，BatchSpanProcessor 清空队列后调用
+func (s *otelStatsExporter) Shutdown(ctx context.Context) error {
+	close(s.shutdown)
+	return s.SpanExporter.Shutdown(ctx)
+}
+
+func (s *otelStatsExporter) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+}
@@ -0,0 +1,396 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// otelBridgeTracer 把 opentracing.Tracer 桥接到 OpenTelemetry，mid 下的中间件无需改动
+	// span 由 OpenTelemetry SDK 创建和导出，跨进程传递使用 W3C Trace Context 和 W3C Baggage
+	otelBridgeTracer struct {
+		tracer     oteltrace.Tracer
+		propagator propagation.TextMapPropagator
+	}
+
+	// otelBridgeSpanContext opentracing.SpanContext 实现，携带 OpenTelemetry span context 和 baggage
+	otelBridgeSpanContext struct {
+		spanContext oteltrace.SpanContext
+		baggage     map[string]string
+	}
+
+	// otelBridgeSpan opentracing.Span 实现，tag 转换为属性，log 转换为事件
+	otelBridgeSpan struct {
+		span   oteltrace.Span
+		tracer *otelBridgeTracer
+
+		mu      sync.RWMutex
+		baggage map[string]string
+	}
+
+	// otelTextMapCarrier 把 opentracing 的 TextMap carrier 适配为 propagation.TextMapCarrier
+	otelTextMapCarrier struct {
+		values map[string]string
+		writer opentracing.TextMapWriter
+	}
+)
+
+func newOTelBridgeTracer(tracer oteltrace.Tracer) *otelBridgeTracer {
+	return &otelBridgeTracer{
+		tracer:     tracer,
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+}
+
+// StartSpan 实现 opentracing.Tracer
+// 第一个有效的 ChildOf 引用作为父 span，没有时使用第一个 FollowsFrom 引用，其余引用转换为 Link
+func (t *otelBridgeTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	sso := opentracing.StartSpanOptions{}
+	for _, opt := range opts {
+		opt.Apply(&sso)
+	}
+
+	var (
+		parent  *otelBridgeSpanContext
+		refs    []otelBridgeSpanContext
+		baggage map[string]string
+	)
+	for _, ref := range sso.References {
+		refCtx, ok := ref.ReferencedContext.(otelBridgeSpanContext)
+		if !ok {
+			continue
+		}
+		for k, v := range refCtx.baggage {
+			if baggage == nil {
+				baggage = make(map[string]string, len(refCtx.baggage))
+			}
+			baggage[k] = v
+		}
+		if !refCtx.spanContext.IsValid() {
+			continue
+		}
+		if parent == nil && ref.Type == opentracing.ChildOfRef {
+			parent = &refCtx
+			continue
+		}
+		refs = append(refs, refCtx)
+	}
+	if parent == nil && len(refs) > 0 {
+		parent, refs = &refs[0], refs[1:]
+	}
+
+	ctx := context.Background()
+	if parent != nil {
+		if parent.spanContext.IsRemote() {
+			ctx = oteltrace.ContextWithRemoteSpanContext(ctx, parent.spanContext)
+		} else {
+			ctx = oteltrace.ContextWithSpanContext(ctx, parent.spanContext)
+		}
+	}
+	startOpts := []oteltrace.SpanStartOption{}
+	if !sso.StartTime.IsZero() {
+		startOpts = append(startOpts, oteltrace.WithTimestamp(sso.StartTime))
+	}
+	for _, ref := range refs {
+		startOpts = append(startOpts, oteltrace.WithLinks(oteltrace.Link{SpanContext: ref.spanContext}))
+	}
+	attrs := make([]attribute.KeyValue, 0, len(sso.Tags))
+	isError := false
+	for k, v := range sso.Tags {
+		switch k {
+		case string(ext.SpanKind):
+			startOpts = append(startOpts, oteltrace.WithSpanKind(otelSpanKind(v)))
+			continue
+		case string(ext.Error):
+			isError, _ = v.(bool)
+		}
+		attrs = append(attrs, otelAttribute(k, v))
+	}
+	startOpts = append(startOpts, oteltrace.WithAttributes(attrs...))
+
+	_, span := t.tracer.Start(ctx, operationName, startOpts...)
+	if isError {
+		span.SetStatus(codes.Error, "")
+	}
+	return &otelBridgeSpan{span: span, tracer: t, baggage: baggage}
+}
+
+// Inject 实现 opentracing.Tracer，支持 HTTPHeaders 和 TextMap
+func (t *otelBridgeTracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := sm.(otelBridgeSpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return opentracing.ErrUnsupportedFormat
+	}
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	ctx := oteltrace.ContextWithSpanContext(context.Background(), sc.spanContext)
+	if len(sc.baggage) > 0 {
+		members := make([]baggage.Member, 0, len(sc.baggage))
+		for k, v := range sc.baggage {
+			// 不合法的 key 无法按 W3C Baggage 传递，直接丢弃
+			member, e := baggage.NewMemberRaw(k, v)
+			if e != nil {
+				continue
+			}
+			members = append(members, member)
+		}
+		if bag, e := baggage.New(members...); e == nil {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
+	}
+	t.propagator.Inject(ctx, otelTextMapCarrier{writer: writer})
+	return nil
+}
+
+// Extract 实现 opentracing.Tracer，支持 HTTPHeaders 和 TextMap
+func (t *otelBridgeTracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+	values := make(map[string]string)
+	if e := reader.ForeachKey(func(key, val string) error {
+		values[strings.ToLower(key)] = val
+		return nil
+	}); e != nil {
+		return nil, e
+	}
+
+	ctx := t.propagator.Extract(context.Background(), otelTextMapCarrier{values: values})
+	sc := otelBridgeSpanContext{spanContext: oteltrace.SpanContextFromContext(ctx)}
+	if members := baggage.FromContext(ctx).Members(); len(members) > 0 {
+		sc.baggage = make(map[string]string, len(members))
+		for _, member := range members {
+			sc.baggage[member.Key()] = member.Value()
+		}
+	}
+	if !sc.spanContext.IsValid() && len(sc.baggage) == 0 {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	return sc, nil
+}
+
+// ForeachBaggageItem 实现 opentracing.SpanContext
+func (c otelBridgeSpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range c.baggage {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+// OTelSpanContext OpenTelemetry span context，mid 通过它读取 trace id 和采样标记
+func (c otelBridgeSpanContext) OTelSpanContext() oteltrace.SpanContext {
+	return c.spanContext
+}
+
+// Finish 实现 opentracing.Span
+func (s *otelBridgeSpan) Finish() {
+	s.span.End()
+}
+
+// FinishWithOptions 实现 opentracing.Span
+func (s *otelBridgeSpan) FinishWithOptions(opts opentracing.FinishOptions) {
+	for _, record := range opts.LogRecords {
+		s.addEvent(record)
+	}
+	for _, data := range opts.BulkLogData {
+		s.addEvent(data.ToLogRecord())
+	}
+	var endOpts []oteltrace.SpanEndOption
+	if !opts.FinishTime.IsZero() {
+		endOpts = append(endOpts, oteltrace.WithTimestamp(opts.FinishTime))
+	}
+	s.span.End(endOpts...)
+}
+
+// Context 实现 opentracing.Span
+func (s *otelBridgeSpan) Context() opentracing.SpanContext {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var baggage map[string]string
+	if len(s.baggage) > 0 {
+		baggage = make(map[string]string, len(s.baggage))
+		for k, v := range s.baggage {
+			baggage[k] = v
+		}
+	}
+	return otelBridgeSpanContext{spanContext: s.span.SpanContext(), baggage: baggage}
+}
+
+// SetOperationName 实现 opentracing.Span
+func (s *otelBridgeSpan) SetOperationName(operationName string) opentracing.Span {
+	s.span.SetName(operationName)
+	return s
+}
+
+// SetTag 实现 opentracing.Span，error=true 同时把 span 状态设置为 Error
+func (s *otelBridgeSpan) SetTag(key string, value interface{}) opentracing.Span {
+	if key == string(ext.Error) {
+		if isError, _ := value.(bool); isError {
+			s.span.SetStatus(codes.Error, "")
+		}
+	}
+	s.span.SetAttributes(otelAttribute(key, value))
+	return s
+}
+
+// LogFields 实现 opentracing.Span，event 字段作为事件名称，没有时为 "log"
+func (s *otelBridgeSpan) LogFields(fields ...log.Field) {
+	s.addEvent(opentracing.LogRecord{Fields: fields})
+}
+
+// LogKV 实现 opentracing.Span
+func (s *otelBridgeSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, e := log.InterleavedKVToFields(alternatingKeyValues...)
+	if e != nil {
+		s.LogFields(log.Error(e), log.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+// SetBaggageItem 实现 opentracing.Span
+func (s *otelBridgeSpan) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.baggage == nil {
+		s.baggage = make(map[string]string)
+	}
+	s.baggage[restrictedKey] = value
+	return s
+}
+
+// BaggageItem 实现 opentracing.Span
+func (s *otelBridgeSpan) BaggageItem(restrictedKey string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.baggage[restrictedKey]
+}
+
+// Tracer 实现 opentracing.Span
+func (s *otelBridgeSpan) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+// LogEvent 实现 opentracing.Span，已废弃
+func (s *otelBridgeSpan) LogEvent(event string) {
+	s.Log(opentracing.LogData{Event: event})
+}
+
+// LogEventWithPayload 实现 opentracing.Span，已废弃
+func (s *otelBridgeSpan) LogEventWithPayload(event string, payload interface{}) {
+	s.Log(opentracing.LogData{Event: event, Payload: payload})
+}
+
+// Log 实现 opentracing.Span，已废弃
+func (s *otelBridgeSpan) Log(data opentracing.LogData) {
+	s.addEvent(data.ToLogRecord())
+}
+
+func (s *otelBridgeSpan) addEvent(record opentracing.LogRecord) {
+	name := "log"
+	attrs := make([]attribute.KeyValue, 0, len(record.Fields))
+	for _, field := range record.Fields {
+		if field.Key() == "event" {
+			name = fmt.Sprint(field.Value())
+			continue
+		}
+		attrs = append(attrs, otelAttribute(field.Key(), field.Value()))
+	}
+	opts := []oteltrace.EventOption{oteltrace.WithAttributes(attrs...)}
+	if !record.Timestamp.IsZero() {
+		opts = append(opts, oteltrace.WithTimestamp(record.Timestamp))
+	}
+	s.span.AddEvent(name, opts...)
+}
+
+// Get 实现 propagation.TextMapCarrier
+func (c otelTextMapCarrier) Get(key string) string {
+	return c.values[strings.ToLower(key)]
+}
+
+// Set 实现 propagation.TextMapCarrier
+func (c otelTextMapCarrier) Set(key, value string) {
+	if c.writer != nil {
+		c.writer.Set(key, value)
+	}
+}
+
+// Keys 实现 propagation.TextMapCarrier
+func (c otelTextMapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func otelSpanKind(v interface{}) oteltrace.SpanKind {
+	switch fmt.Sprint(v) {
+	case string(ext.SpanKindRPCServerEnum):
+		return oteltrace.SpanKindServer
+	case string(ext.SpanKindRPCClientEnum):
+		return oteltrace.SpanKindClient
+	case string(ext.SpanKindProducerEnum):
+		return oteltrace.SpanKindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return oteltrace.SpanKindConsumer
+	}
+	return oteltrace.SpanKindInternal
+}
+
+func otelAttribute(key string, v interface{}) attribute.KeyValue {
+	switch value := v.(type) {
+	case string:
+		return attribute.String(key, value)
+	case bool:
+		return attribute.Bool(key, value)
+	case int:
+		return attribute.Int(key, value)
+	case int8:
+		return attribute.Int64(key, int64(value))
+	case int16:
+		return attribute.Int64(key, int64(value))
+	case int32:
+		return attribute.Int64(key, int64(value))
+	case int64:
+		return attribute.Int64(key, value)
+	case uint:
+		return attribute.Int64(key, int64(value))
+	case uint8:
+		return attribute.Int64(key, int64(value))
+	case uint16:
+		return attribute.Int64(key, int64(value))
+	case uint32:
+		return attribute.Int64(key, int64(value))
+	case uint64:
+		return attribute.Int64(key, int64(value))
+	case float32:
+		return attribute.Float64(key, float64(value))
+	case float64:
+		return attribute.Float64(key, value)
+	}
+	return attribute.String(key, fmt.Sprint(v))
+}
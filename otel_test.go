@@ -0,0 +1,214 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-lib/metrics"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+func TestOTLPExport(t *testing.T) {
+	httpReceiver := tracetest.NewOTLPReceiver()
+	defer httpReceiver.Close()
+	grpcReceiver, e := tracetest.NewOTLPGRPCReceiver()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer grpcReceiver.Close()
+
+	cases := []struct {
+		name        string
+		receiver    *tracetest.OTLPReceiver
+		protocol    string
+		compression string
+	}{
+		{name: "http", receiver: httpReceiver, protocol: trace.OTLPProtocolHTTPProtobuf, compression: trace.OTLPCompressionNone},
+		{name: "http gzip", receiver: httpReceiver, protocol: trace.OTLPProtocolHTTPProtobuf, compression: trace.OTLPCompressionGzip},
+		{name: "grpc", receiver: grpcReceiver, protocol: trace.OTLPProtocolGRPC, compression: trace.OTLPCompressionNone},
+		{name: "grpc gzip", receiver: grpcReceiver, protocol: trace.OTLPProtocolGRPC, compression: trace.OTLPCompressionGzip},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.receiver.Reset()
+			tracer, e := trace.NewTracer("otlp-test", "",
+				trace.WithOTLPEndpoint(c.receiver.Endpoint()),
+				trace.WithOTLPProtocol(c.protocol),
+				trace.WithOTLPCompression(c.compression),
+				trace.WithOTLPHeaders(map[string]string{"X-Token": "secret"}),
+				trace.WithTags(opentracing.Tag{Key: "env", Value: "test"}),
+			)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			parent := tracer.StartSpan("parent", ext.SpanKindRPCServer)
+			child := tracer.StartSpan("child", opentracing.ChildOf(parent.Context()),
+				opentracing.Tag{Key: "db.rows", Value: 3})
+			ext.Error.Set(child, true)
+			child.LogFields(log.String("event", "error"), log.String("message", "boom"))
+			child.Finish()
+			parent.Finish()
+
+			if e := tracer.Shutdown(context.Background()); e != nil {
+				t.Fatal(e)
+			}
+			if stats := tracer.Stats(); stats.Finished != 2 || stats.Flushed != 2 || stats.Pending() != 0 {
+				t.Fatalf("unexpected stats: %s", stats)
+			}
+
+			spans := c.receiver.WaitForSpans(2, time.Second)
+			if len(spans) != 2 {
+				t.Fatalf("expected 2 spans, got %d", len(spans))
+			}
+			byName := map[string]*tracepb.Span{}
+			for _, span := range spans {
+				byName[span.GetName()] = span
+			}
+			p, ch := byName["parent"], byName["child"]
+			if p == nil || ch == nil {
+				t.Fatalf("missing spans: %v", byName)
+			}
+			if p.GetKind() != tracepb.Span_SPAN_KIND_SERVER {
+				t.Errorf("parent kind = %v", p.GetKind())
+			}
+			if !bytes.Equal(ch.GetTraceId(), p.GetTraceId()) || !bytes.Equal(ch.GetParentSpanId(), p.GetSpanId()) {
+				t.Errorf("child is not linked to parent")
+			}
+			if ch.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+				t.Errorf("child status = %v", ch.GetStatus())
+			}
+			if len(ch.GetEvents()) != 1 || ch.GetEvents()[0].GetName() != "error" {
+				t.Errorf("child events = %v", ch.GetEvents())
+			}
+			if !hasIntAttribute(ch, "db.rows", 3) {
+				t.Errorf("child attributes = %v", ch.GetAttributes())
+			}
+
+			req := c.receiver.Requests()[0]
+			attrs := map[string]string{}
+			for _, kv := range req.GetResourceSpans()[0].GetResource().GetAttributes() {
+				attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+			}
+			if attrs["service.name"] != "otlp-test" || attrs["env"] != "test" {
+				t.Errorf("resource attributes = %v", attrs)
+			}
+			if got := http.Header(c.receiver.Headers()[0]).Get("X-Token"); got != "secret" {
+				t.Errorf("header X-Token = %q", got)
+			}
+		})
+	}
+}
+
+func TestOTLPPropagation(t *testing.T) {
+	receiver := tracetest.NewOTLPReceiver()
+	defer receiver.Close()
+	tracer, e := trace.NewTracer("otlp-test", "", trace.WithOTLPEndpoint(receiver.Endpoint()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tracer.Close()
+
+	span := tracer.StartSpan("client")
+	span.SetBaggageItem("user", "a b")
+	header := http.Header{}
+	if e := tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); e != nil {
+		t.Fatal(e)
+	}
+	span.Finish()
+	if header.Get("Traceparent") == "" {
+		t.Fatalf("traceparent not injected: %v", header)
+	}
+	if got := header.Get("Baggage"); got != "user=a%20b" {
+		t.Errorf("baggage header = %q", got)
+	}
+
+	spanCtx, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if e != nil {
+		t.Fatal(e)
+	}
+	server := tracer.StartSpan("server", ext.RPCServerOption(spanCtx))
+	if got := server.BaggageItem("user"); got != "a b" {
+		t.Errorf("baggage user = %q", got)
+	}
+	server.Finish()
+
+	if _, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); e != opentracing.ErrSpanContextNotFound {
+		t.Errorf("extract from empty header, err:%v", e)
+	}
+}
+
+func TestOTLPValidate(t *testing.T) {
+	cases := map[string][]trace.Option{
+		"http/json":       {trace.WithOTLPProtocol("http/json")},
+		"ratelimiting":    {trace.WithSamplerType("ratelimiting")},
+		"jaeger header":   {trace.WithPropagation(trace.PropagationJaeger)},
+		"file reporter":   {trace.WithFileReporter("spans.jsonl")},
+		"tail sampling":   {trace.WithTailSampling(time.Second, time.Second, 0.1)},
+		"metrics factory": {trace.WithMetricsFactory(metrics.NullFactory)},
+	}
+	for name, opts := range cases {
+		opts = append(opts, trace.WithOTLPEndpoint("http://127.0.0.1:4318/v1/traces"))
+		if _, e := trace.NewTracer("otlp-test", "", opts...); e == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func hasIntAttribute(span *tracepb.Span, key string, value int64) bool {
+	for _, kv := range span.GetAttributes() {
+		if kv.GetKey() == key {
+			return kv.GetValue().GetIntValue() == value
+		}
+	}
+	return false
+}
+
+func TestOTLPCloseAbortsRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tracer, e := trace.NewTracer("otlp-test", "",
+		trace.WithOTLPEndpoint(server.URL+tracetest.OTLPTracesPath),
+		trace.WithReporterQueueSize(1),
+		trace.WithBufferFlushInterval(time.Second),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tracer.StartSpan("first").Finish()
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 第一批在退避重试，新的 span 仍然可以进入队列
+	for i := 0; i < 10; i++ {
+		tracer.StartSpan("queued").Finish()
+	}
+
+	start := time.Now()
+	if e := tracer.Close(); e == nil {
+		t.Error("expected close error after timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 7*time.Second {
+		t.Errorf("close took %v", elapsed)
+	}
+	stats := tracer.Stats()
+	if stats.Finished != 11 || stats.Flushed != 0 || stats.Failed+stats.Dropped != 11 || stats.Pending() != 0 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
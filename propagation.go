@@ -0,0 +1,376 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/zipkin"
+)
+
+// Propagation 跨进程传递链路上下文的格式
+type Propagation string
+
+const (
+	// PropagationJaeger jaeger 默认格式，uber-trace-id 及 uberctx-* baggage
+	PropagationJaeger Propagation = "jaeger"
+	// PropagationW3C W3C Trace Context 格式，traceparent 及 tracestate
+	PropagationW3C Propagation = "w3c"
+	// PropagationB3 zipkin B3 多 header 格式，X-B3-TraceId、X-B3-SpanId、X-B3-ParentSpanId、X-B3-Sampled
+	PropagationB3 Propagation = "b3"
+	// PropagationB3Single zipkin B3 单 header 格式，b3: {traceId}-{spanId}-{sampled}-{parentSpanId}
+	PropagationB3Single Propagation = "b3single"
+)
+
+const (
+	w3cTraceParentHeader = "traceparent"
+	w3cTraceStateHeader  = "tracestate"
+	b3SingleHeader       = "b3"
+)
+
+type (
+	// compositePropagator 注入时写入全部格式；提取时按顺序尝试，使用第一个有效的上下文，
+	// 其余格式中的 baggage 合并进来，同一 trace 的 tracestate 也会保留
+	compositePropagator struct {
+		injectors  []jaeger.Injector
+		extractors []jaeger.Extractor
+	}
+
+	// w3cPropagator W3C Trace Context，https://www.w3.org/TR/trace-context/
+	w3cPropagator struct{}
+
+	// w3cTraceStateKey 上游传入的 tracestate 保存在 span context 的 ExtendedSamplingState 中，进程内的子 span 共享，
+	// 只有 w3cPropagator 注入时带上，不会作为 baggage 传到其他格式或提升为 tag
+	w3cTraceStateKey struct{}
+
+	// b3SinglePropagator zipkin B3 单 header 格式，https://github.com/openzipkin/b3-propagation
+	b3SinglePropagator struct{}
+)
+
+/*
+WithPropagation 设置 跨进程传递链路上下文的格式，作用于 HTTPHeaders 和 TextMap，mid 下的中间件都会使用
+注入时写入全部格式，提取时按顺序尝试，例如迁移期间使用 WithPropagation(PropagationW3C, PropagationJaeger)
+默认只使用 PropagationJaeger
+Args:
+ - propagations: 传递格式，PropagationJaeger、PropagationW3C、PropagationB3 或 PropagationB3Single
+*/
+func WithPropagation(propagations ...Propagation) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.propagations = propagations
+	}
+}
+
+// validatePropagation 校验传递格式
+func validatePropagation(p Propagation) error {
+	switch p {
+	case PropagationJaeger, PropagationW3C, PropagationB3, PropagationB3Single:
+		return nil
+	}
+	return fmt.Errorf("unknown propagation %q, expecting one of %s, %s, %s, %s",
+		p, PropagationJaeger, PropagationW3C, PropagationB3, PropagationB3Single)
+}
+
+// newPropagators 按 HTTPHeaders 和 TextMap 分别创建组合 propagator，未设置时返回 nil 使用 jaeger 默认格式
+func (o *jaegerTracerOptions) newPropagators(metrics *jaeger.Metrics) (httpHeaders, textMap *compositePropagator) {
+	if len(o.propagations) == 0 {
+		return nil, nil
+	}
+	headers := jaeger.HeadersConfig{}
+	if o.headers != nil {
+		headers = *o.headers
+	}
+	headers.ApplyDefaults()
+
+	httpHeaders, textMap = &compositePropagator{}, &compositePropagator{}
+	for _, p := range o.propagations {
+		switch p {
+		case PropagationJaeger:
+			httpHeaders.add(jaeger.NewHTTPHeaderPropagator(&headers, *metrics))
+			textMap.add(jaeger.NewTextMapPropagator(&headers, *metrics))
+		case PropagationW3C:
+			httpHeaders.add(w3cPropagator{})
+			textMap.add(w3cPropagator{})
+		case PropagationB3:
+			b3 := zipkin.NewZipkinB3HTTPHeaderPropagator()
+			httpHeaders.add(b3)
+			textMap.add(b3)
+		case PropagationB3Single:
+			httpHeaders.add(b3SinglePropagator{})
+			textMap.add(b3SinglePropagator{})
+		}
+	}
+	return httpHeaders, textMap
+}
+
+func (p *compositePropagator) add(propagator interface {
+	jaeger.Injector
+	jaeger.Extractor
+}) {
+	p.injectors = append(p.injectors, propagator)
+	p.extractors = append(p.extractors, propagator)
+}
+
+// Inject 实现 jaeger.Injector
+func (p *compositePropagator) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	for _, injector := range p.injectors {
+		if e := injector.Inject(ctx, carrier); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Extract 实现 jaeger.Extractor
+func (p *compositePropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	var (
+		found    bool
+		ctx      jaeger.SpanContext
+		fallback []jaeger.SpanContext
+		firstErr error
+	)
+	for _, extractor := range p.extractors {
+		c, e := extractor.Extract(carrier)
+		switch {
+		case e == opentracing.ErrSpanContextNotFound:
+		case e != nil:
+			if firstErr == nil {
+				firstErr = e
+			}
+		case !found && c.IsValid():
+			found, ctx = true, c
+		default:
+			fallback = append(fallback, c)
+		}
+	}
+
+	if !found {
+		if len(fallback) > 0 {
+			// 只有 baggage 或 jaeger-debug-id，交给 jaeger 处理
+			return fallback[0], nil
+		}
+		if firstErr != nil {
+			return jaeger.SpanContext{}, firstErr
+		}
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	for _, c := range fallback {
+		if c.IsValid() && c.TraceID() == ctx.TraceID() && traceState(ctx) == "" {
+			setTraceState(ctx, traceState(c))
+		}
+		c.ForeachBaggageItem(func(k, v string) bool {
+			if baggageItem(ctx, k) == "" {
+				ctx = ctx.WithBaggageItem(k, v)
+			}
+			return true
+		})
+	}
+	return ctx, nil
+}
+
+// Inject 实现 jaeger.Injector
+func (w3cPropagator) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	if !ctx.IsValid() {
+		return nil
+	}
+	flags := "00"
+	if ctx.IsSampled() {
+		flags = "01"
+	}
+	traceID := ctx.TraceID()
+	writer.Set(w3cTraceParentHeader, fmt.Sprintf("00-%016x%016x-%016x-%s", traceID.High, traceID.Low, uint64(ctx.SpanID()), flags))
+	if state := traceState(ctx); state != "" {
+		writer.Set(w3cTraceStateHeader, state)
+	}
+	return nil
+}
+
+// Extract 实现 jaeger.Extractor
+func (w3cPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var parents, states []string
+	e := reader.ForeachKey(func(key, value string) error {
+		switch strings.ToLower(key) {
+		case w3cTraceParentHeader:
+			parents = append(parents, value)
+		case w3cTraceStateHeader:
+			states = append(states, value)
+		}
+		return nil
+	})
+	if e != nil {
+		return jaeger.SpanContext{}, e
+	}
+	switch len(parents) {
+	case 0:
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	case 1:
+	default:
+		// 多个 traceparent 无法确定父 span，按规范视为无效
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	traceID, spanID, sampled, e := parseTraceParent(parents[0])
+	if e != nil {
+		return jaeger.SpanContext{}, e
+	}
+	ctx := jaeger.NewSpanContext(traceID, spanID, 0, sampled, nil)
+	setTraceState(ctx, strings.Join(states, ","))
+	return ctx, nil
+}
+
+// parseTraceParent 解析 "version-traceid-parentid-flags"，只接受小写十六进制，未知的更高版本只解析前四段
+func parseTraceParent(value string) (traceID jaeger.TraceID, spanID jaeger.SpanID, sampled bool, e error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	version, e := strconv.ParseUint(parts[0], 16, 8)
+	if e != nil || version == 0xff || (version == 0 && len(parts) != 4) {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	if traceID.High, e = strconv.ParseUint(parts[1][:16], 16, 64); e != nil {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	if traceID.Low, e = strconv.ParseUint(parts[1][16:], 16, 64); e != nil {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	id, e := strconv.ParseUint(parts[2], 16, 64)
+	if e != nil {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	flags, e := strconv.ParseUint(parts[3], 16, 8)
+	if e != nil {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	spanID = jaeger.SpanID(id)
+	if !traceID.IsValid() || spanID == 0 {
+		return traceID, spanID, false, opentracing.ErrSpanContextCorrupted
+	}
+	return traceID, spanID, flags&0x01 == 0x01, nil
+}
+
+// Inject 实现 jaeger.Injector
+func (b3SinglePropagator) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	if !ctx.IsValid() {
+		return nil
+	}
+	sampling := "0"
+	if ctx.IsDebug() {
+		sampling = "d"
+	} else if ctx.IsSampled() {
+		sampling = "1"
+	}
+	value := ctx.TraceID().String() + "-" + ctx.SpanID().String() + "-" + sampling
+	if ctx.ParentID() != 0 {
+		value += "-" + ctx.ParentID().String()
+	}
+	writer.Set(b3SingleHeader, value)
+	return nil
+}
+
+// Extract 实现 jaeger.Extractor，只有采样标记（例如 "b3: 0"）时视为没有上下文
+func (b3SinglePropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var value string
+	e := reader.ForeachKey(func(key, v string) error {
+		if strings.ToLower(key) == b3SingleHeader {
+			value = v
+		}
+		return nil
+	})
+	if e != nil {
+		return jaeger.SpanContext{}, e
+	}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 2 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	if len(parts) > 4 || (len(parts[0]) != 16 && len(parts[0]) != 32) || len(parts[1]) != 16 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	traceID, e := jaeger.TraceIDFromString(parts[0])
+	if e != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, e := jaeger.SpanIDFromString(parts[1])
+	if e != nil || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	sampled := false
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			sampled = true
+		case "0":
+		default:
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	var parentID jaeger.SpanID
+	if len(parts) > 3 {
+		if parentID, e = jaeger.SpanIDFromString(parts[3]); e != nil || len(parts[3]) != 16 {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	return jaeger.NewSpanContext(traceID, spanID, parentID, sampled, nil), nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func baggageItem(ctx jaeger.SpanContext, key string) (value string) {
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if k == key {
+			value = v
+			return false
+		}
+		return true
+	})
+	return value
+}
+
+// traceState 读取上游传入的 tracestate，ctx 必须有效
+func traceState(ctx jaeger.SpanContext) string {
+	state, _ := traceStateValue(ctx).Load().(string)
+	return state
+}
+
+// setTraceState 保存 tracestate，进程内同一 trace 的 span 共享，ctx 必须有效
+func setTraceState(ctx jaeger.SpanContext, state string) {
+	if state != "" {
+		traceStateValue(ctx).Store(state)
+	}
+}
+
+func traceStateValue(ctx jaeger.SpanContext) *atomic.Value {
+	return ctx.ExtendedSamplingState(w3cTraceStateKey{}, func() interface{} { return new(atomic.Value) }).(*atomic.Value)
+}
@@ -0,0 +1,230 @@
+package trace_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+func newPropagationTracer(t *testing.T, propagations ...trace.Propagation) *trace.Tracer {
+	tracer, e := trace.NewTracer("propagation-test", "",
+		trace.WithPropagation(propagations...),
+		trace.WithReporter(jaeger.NewInMemoryReporter()),
+		trace.WithReporterLogSpans(false),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = tracer.Close() })
+	return tracer
+}
+
+func TestW3CExtract(t *testing.T) {
+	tracer := newPropagationTracer(t, trace.PropagationW3C)
+	cases := map[string]struct {
+		traceparent []string
+		traceID     string
+		spanID      string
+		sampled     bool
+		e           error
+	}{
+		"sampled": {
+			traceparent: []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			traceID:     "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331", sampled: true,
+		},
+		"not sampled": {
+			traceparent: []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"},
+			traceID:     "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331",
+		},
+		"future version": {
+			traceparent: []string{"cc-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-what-the-future-will-be-like"},
+			traceID:     "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331", sampled: true,
+		},
+		"missing":         {e: opentracing.ErrSpanContextNotFound},
+		"uppercase":       {traceparent: []string{"00-0AF7651916CD43DD8448EB211C80319C-B7AD6B7169203331-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"version ff":      {traceparent: []string{"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"zero trace id":   {traceparent: []string{"00-00000000000000000000000000000000-b7ad6b7169203331-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"zero span id":    {traceparent: []string{"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"version 00 tail": {traceparent: []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-00"}, e: opentracing.ErrSpanContextCorrupted},
+		"short trace id":  {traceparent: []string{"00-0af7651916cd43dd8448eb211c8031-b7ad6b7169203331-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"not hex":         {traceparent: []string{"00-0af7651916cd43dd8448eb211c80319g-b7ad6b7169203331-01"}, e: opentracing.ErrSpanContextCorrupted},
+		"multiple": {
+			traceparent: []string{
+				"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+				"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203332-01",
+			},
+			e: opentracing.ErrSpanContextCorrupted,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			for _, v := range c.traceparent {
+				header.Add("Traceparent", v)
+			}
+			spanCtx, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+			if e != c.e {
+				t.Fatalf("err = %v, want %v", e, c.e)
+			}
+			if e != nil {
+				return
+			}
+			sc := spanCtx.(jaeger.SpanContext)
+			traceID := fmt.Sprintf("%016x%016x", sc.TraceID().High, sc.TraceID().Low)
+			spanID := fmt.Sprintf("%016x", uint64(sc.SpanID()))
+			if traceID != c.traceID || spanID != c.spanID || sc.IsSampled() != c.sampled {
+				t.Errorf("got %s-%s sampled=%v", traceID, spanID, sc.IsSampled())
+			}
+		})
+	}
+}
+
+func TestW3CRoundTrip(t *testing.T) {
+	tracer := newPropagationTracer(t, trace.PropagationW3C, trace.PropagationJaeger)
+
+	in := http.Header{}
+	in.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	in.Add("Tracestate", "congo=t61rcWkgMzE")
+	in.Add("Tracestate", "rojo=00f067aa0ba902b7")
+	in.Set("Uberctx-User", "alice")
+	spanCtx, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	server := tracer.StartSpan("server", ext.RPCServerOption(spanCtx))
+	defer server.Finish()
+	client := tracer.StartSpan("client", opentracing.ChildOf(server.Context()))
+	defer client.Finish()
+
+	out := http.Header{}
+	if e := tracer.Inject(client.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); e != nil {
+		t.Fatal(e)
+	}
+	want := fmt.Sprintf("00-0af7651916cd43dd8448eb211c80319c-%016x-01", uint64(client.Context().(jaeger.SpanContext).SpanID()))
+	if got := out.Get("Traceparent"); got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+	if got := out.Get("Tracestate"); got != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Errorf("tracestate = %q", got)
+	}
+	if got := out.Get("Uberctx-User"); got != "alice" {
+		t.Errorf("baggage user = %q", got)
+	}
+	for key := range out {
+		if key != "Traceparent" && key != "Tracestate" && key != "Uber-Trace-Id" && key != "Uberctx-User" {
+			t.Errorf("unexpected header %s: %v", key, out[key])
+		}
+	}
+	client.Context().ForeachBaggageItem(func(k, v string) bool {
+		if k != "user" {
+			t.Errorf("unexpected baggage %s=%s", k, v)
+		}
+		return true
+	})
+}
+
+func TestW3CTraceStateFromFallback(t *testing.T) {
+	tracer := newPropagationTracer(t, trace.PropagationJaeger, trace.PropagationW3C)
+
+	in := http.Header{}
+	in.Set("Uber-Trace-Id", "af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1")
+	in.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	in.Set("Tracestate", "congo=t61rcWkgMzE")
+	spanCtx, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	server := tracer.StartSpan("server", ext.RPCServerOption(spanCtx))
+	defer server.Finish()
+
+	out := http.Header{}
+	if e := tracer.Inject(server.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); e != nil {
+		t.Fatal(e)
+	}
+	if got := out.Get("Tracestate"); got != "congo=t61rcWkgMzE" {
+		t.Errorf("tracestate = %q", got)
+	}
+}
+
+func TestB3SingleExtract(t *testing.T) {
+	tracer := newPropagationTracer(t, trace.PropagationB3Single)
+	cases := map[string]struct {
+		b3       string
+		traceID  string
+		spanID   string
+		parentID string
+		sampled  bool
+		e        error
+	}{
+		"trace and span":  {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1"},
+		"sampled":         {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", sampled: true},
+		"not sampled":     {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1"},
+		"debug":           {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", sampled: true},
+		"parent":          {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", parentID: "05e3ac9a4f6e3b90", sampled: true},
+		"64-bit trace id": {b3: "64fe8b2a57d3eff7-e457b5a2e4d86bd1-1", traceID: "64fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", sampled: true},
+		"only debug":      {b3: "d", e: opentracing.ErrSpanContextNotFound},
+		"only deny":       {b3: "0", e: opentracing.ErrSpanContextNotFound},
+		"missing":         {e: opentracing.ErrSpanContextNotFound},
+		"bad sampled":     {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-x", e: opentracing.ErrSpanContextCorrupted},
+		"bad trace id":    {b3: "80f198ee56343ba864fe-e457b5a2e4d86bd1-1", e: opentracing.ErrSpanContextCorrupted},
+		"short span id":   {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d8-1", e: opentracing.ErrSpanContextCorrupted},
+		"short parent":    {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a", e: opentracing.ErrSpanContextCorrupted},
+		"too many fields": {b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90-1", e: opentracing.ErrSpanContextCorrupted},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			if c.b3 != "" {
+				header.Set("B3", c.b3)
+			}
+			spanCtx, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+			if e != c.e {
+				t.Fatalf("err = %v, want %v", e, c.e)
+			}
+			if e != nil {
+				return
+			}
+			sc := spanCtx.(jaeger.SpanContext)
+			parentID := ""
+			if sc.ParentID() != 0 {
+				parentID = sc.ParentID().String()
+			}
+			if sc.TraceID().String() != c.traceID || sc.SpanID().String() != c.spanID || parentID != c.parentID || sc.IsSampled() != c.sampled {
+				t.Errorf("got %s-%s parent=%s sampled=%v", sc.TraceID(), sc.SpanID(), parentID, sc.IsSampled())
+			}
+		})
+	}
+}
+
+func TestB3SingleInject(t *testing.T) {
+	tracer := newPropagationTracer(t, trace.PropagationB3Single)
+
+	root := tracer.StartSpan("root")
+	defer root.Finish()
+	child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+	defer child.Finish()
+
+	header := http.Header{}
+	if e := tracer.Inject(child.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); e != nil {
+		t.Fatal(e)
+	}
+	sc := child.Context().(jaeger.SpanContext)
+	want := sc.TraceID().String() + "-" + sc.SpanID().String() + "-1-" + sc.ParentID().String()
+	if got := header.Get("B3"); got != want {
+		t.Errorf("b3 = %q, want %q", got, want)
+	}
+
+	extracted, e := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := extracted.(jaeger.SpanContext); got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsSampled() {
+		t.Errorf("round trip got %s", got)
+	}
+}
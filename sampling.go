@@ -0,0 +1,232 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/thrift-gen/sampling"
+)
+
+const defaultSamplingReloadInterval = 10 * time.Second
+
+// fileSampler 从文件加载按 operation 采样策略，定期检查文件修改时间，修改后替换为新的 PerOperationSampler
+type fileSampler struct {
+	path      string
+	interval  time.Duration
+	params    jaeger.PerOperationSamplerParams
+	logger    jaeger.Logger
+	sampler   atomic.Value // *jaeger.PerOperationSampler
+	modTime   time.Time
+	size      int64
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+/*
+WithPerOperationSampling 设置 按 operation 采样策略，设置后 WithSamplerType、WithSamplerParam 不再生效
+格式与 jaeger 远程采样策略中的 operationSampling 相同：默认采样率、各 operation 的采样率，以及每个 operation 每秒最少采样的数量
+Args:
+ - strategies: 采样策略，operation 为 span 的 operation 名称，例如 gin 中间件的路由
+*/
+func WithPerOperationSampling(strategies *sampling.PerOperationSamplingStrategies) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplingStrategies = strategies
+	}
+}
+
+/*
+WithPerOperationSamplingFile 设置 从 JSON 文件加载按 operation 采样策略，文件修改后自动重新加载
+文件内容为 operationSampling 对象，或包含 operationSampling 字段的 jaeger 远程采样响应，例如：
+{"defaultSamplingProbability":0.1,"defaultLowerBoundTracesPerSecond":0.1,
+"perOperationStrategies":[{"operation":"/health","probabilisticSampling":{"samplingRate":0}}]}
+Args:
+ - path: 策略文件路径
+ - reloadInterval: 检查文件修改的间隔，<=0 时使用默认值 10s
+*/
+func WithPerOperationSamplingFile(path string, reloadInterval time.Duration) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplingStrategiesFile = path
+		opts.samplingReloadInterval = reloadInterval
+	}
+}
+
+// LoadSamplingStrategiesFile 读取按 operation 采样策略文件并校验
+func LoadSamplingStrategiesFile(path string) (*sampling.PerOperationSamplingStrategies, error) {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	resp := &sampling.SamplingStrategyResponse{}
+	if e = json.Unmarshal(data, resp); e != nil {
+		return nil, fmt.Errorf("parse sampling strategies file %s failed, err:%v", path, e)
+	}
+	strategies := resp.OperationSampling
+	if strategies == nil {
+		strategies = &sampling.PerOperationSamplingStrategies{}
+		if e = json.Unmarshal(data, strategies); e != nil {
+			return nil, fmt.Errorf("parse sampling strategies file %s failed, err:%v", path, e)
+		}
+	}
+	if e = validateSamplingStrategies(strategies); e != nil {
+		return nil, fmt.Errorf("invalid sampling strategies file %s, err:%v", path, e)
+	}
+	return strategies, nil
+}
+
+// validateSamplingStrategies 校验采样率在 0 到 1 之间，每秒最少采样数量不能为负数
+func validateSamplingStrategies(strategies *sampling.PerOperationSamplingStrategies) error {
+	if p := strategies.DefaultSamplingProbability; p < 0 || p > 1 {
+		return fmt.Errorf("invalid default sampling probability %v, expecting value between 0 and 1", p)
+	}
+	if strategies.DefaultLowerBoundTracesPerSecond < 0 {
+		return fmt.Errorf("invalid default lower bound traces per second %v, cannot be negative",
+			strategies.DefaultLowerBoundTracesPerSecond)
+	}
+	for _, strategy := range strategies.PerOperationStrategies {
+		if strategy == nil || strategy.Operation == "" {
+			return errors.New("operation sampling strategy requires an operation name")
+		}
+		if strategy.ProbabilisticSampling == nil {
+			return fmt.Errorf("operation %q requires probabilisticSampling", strategy.Operation)
+		}
+		if r := strategy.ProbabilisticSampling.SamplingRate; r < 0 || r > 1 {
+			return fmt.Errorf("invalid sampling rate %v for operation %q, expecting value between 0 and 1", r, strategy.Operation)
+		}
+	}
+	return nil
+}
+
+// newSampler 创建按 operation 采样的 sampler，返回 nil 时使用 jaeger 根据 SamplerConfig 创建的 sampler
+func (o *jaegerTracerOptions) newSampler(logger jaeger.Logger) (jaeger.Sampler, error) {
+	if o.disable {
+		return nil, nil
+	}
+	params := jaeger.PerOperationSamplerParams{
+		MaxOperations:            o.samplerMaxOperations,
+		OperationNameLateBinding: o.samplerOperationNameLateBinding,
+		Strategies:               o.samplingStrategies,
+	}
+	if o.samplingStrategiesFile != "" {
+		return newFileSampler(o.samplingStrategiesFile, o.samplingReloadInterval, params, logger)
+	}
+	if o.samplingStrategies != nil {
+		return jaeger.NewPerOperationSampler(params), nil
+	}
+	return nil, nil
+}
+
+func newFileSampler(path string, interval time.Duration, params jaeger.PerOperationSamplerParams,
+	logger jaeger.Logger) (*fileSampler, error) {
+	if interval <= 0 {
+		interval = defaultSamplingReloadInterval
+	}
+	if logger == nil {
+		logger = jaeger.NullLogger
+	}
+	s := &fileSampler{
+		path:     path,
+		interval: interval,
+		params:   params,
+		logger:   logger,
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if e := s.load(); e != nil {
+		return nil, e
+	}
+	go s.watch()
+	return s, nil
+}
+
+func (s *fileSampler) current() *jaeger.PerOperationSampler {
+	return s.sampler.Load().(*jaeger.PerOperationSampler)
+}
+
+// load 文件修改时间或大小变化时重新加载，加载失败时保留之前的策略
+func (s *fileSampler) load() error {
+	info, e := os.Stat(s.path)
+	if e != nil {
+		return e
+	}
+	if s.sampler.Load() != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	strategies, e := LoadSamplingStrategiesFile(s.path)
+	if e != nil {
+		return e
+	}
+	params := s.params
+	params.Strategies = strategies
+	old, _ := s.sampler.Load().(*jaeger.PerOperationSampler)
+	s.sampler.Store(jaeger.NewPerOperationSampler(params))
+	s.modTime, s.size = info.ModTime(), info.Size()
+	if old != nil {
+		old.Close()
+		s.logger.Infof("sampling strategies reloaded from %s", s.path)
+	}
+	return nil
+}
+
+func (s *fileSampler) watch() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if e := s.load(); e != nil {
+				s.logger.Error(fmt.Sprintf("reload sampling strategies failed, err:%v", e))
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// IsSampled 实现 jaeger.Sampler，按 operation 采样只使用 SamplerV2 接口
+func (s *fileSampler) IsSampled(id jaeger.TraceID, operation string) (bool, []jaeger.Tag) {
+	return s.current().IsSampled(id, operation)
+}
+
+// Equal 实现 jaeger.Sampler
+func (s *fileSampler) Equal(other jaeger.Sampler) bool {
+	return false
+}
+
+// OnCreateSpan 实现 jaeger.SamplerV2
+func (s *fileSampler) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.current().OnCreateSpan(span)
+}
+
+// OnSetOperationName 实现 jaeger.SamplerV2
+func (s *fileSampler) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	return s.current().OnSetOperationName(span, operationName)
+}
+
+// OnSetTag 实现 jaeger.SamplerV2
+func (s *fileSampler) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	return s.current().OnSetTag(span, key, value)
+}
+
+// OnFinishSpan 实现 jaeger.SamplerV2
+func (s *fileSampler) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.current().OnFinishSpan(span)
+}
+
+// Close 实现 jaeger.SamplerV2，停止检查文件
+func (s *fileSampler) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		<-s.done
+		s.current().Close()
+	})
+}
@@ -0,0 +1,262 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/thrift-gen/sampling"
+)
+
+const defaultSamplingProbability = 0.001
+
+type (
+	// SamplingStrategies jaeger collector 策略文件格式，按服务配置采样策略，未配置的服务使用 default_strategy
+	SamplingStrategies struct {
+		ServiceStrategies []ServiceSamplingStrategy `json:"service_strategies"`
+		DefaultStrategy   *SamplingStrategy         `json:"default_strategy"`
+	}
+
+	// ServiceSamplingStrategy 单个服务的采样策略
+	ServiceSamplingStrategy struct {
+		Service string `json:"service"`
+		SamplingStrategy
+	}
+
+	// SamplingStrategy 采样策略，Type 为 probabilistic（Param 为采样率）或 ratelimiting（Param 为每秒采样数）
+	// 只有 probabilistic 策略支持 OperationStrategies
+	SamplingStrategy struct {
+		Type                string                      `json:"type"`
+		Param               float64                     `json:"param"`
+		OperationStrategies []OperationSamplingStrategy `json:"operation_strategies,omitempty"`
+	}
+
+	// OperationSamplingStrategy 单个 operation 的采样策略，只支持 probabilistic
+	OperationSamplingStrategy struct {
+		Operation string  `json:"operation"`
+		Type      string  `json:"type"`
+		Param     float64 `json:"param"`
+	}
+
+	// SamplingHandler 根据本地策略文件提供 jaeger 远程采样协议 GET /sampling?service=，可以挂载到任意路由
+	// 追踪器使用 WithSamplerType("remote") 并通过 WithSamplingServerURL 指向该地址
+	SamplingHandler struct {
+		path     string
+		interval time.Duration
+
+		mu        sync.Mutex
+		responses map[string]*sampling.SamplingStrategyResponse
+		fallback  *sampling.SamplingStrategyResponse
+		checkedAt time.Time
+		modTime   time.Time
+		size      int64
+	}
+)
+
+/*
+NewSamplingHandler 创建远程采样策略 HTTP handler，请求时按 reloadInterval 检查文件修改并重新加载
+Args:
+ - path: 策略文件路径，格式同 jaeger collector 的 --sampling.strategies-file
+ - reloadInterval: 检查文件修改的间隔，<=0 时使用默认值 10s
+*/
+func NewSamplingHandler(path string, reloadInterval time.Duration) (*SamplingHandler, error) {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultSamplingReloadInterval
+	}
+	h := &SamplingHandler{path: path, interval: reloadInterval}
+	if e := h.reload(); e != nil {
+		return nil, e
+	}
+	return h, nil
+}
+
+// LoadSamplingStrategies 读取 jaeger collector 格式的策略文件并校验
+func LoadSamplingStrategies(path string) (*SamplingStrategies, error) {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	strategies := &SamplingStrategies{}
+	if e = json.Unmarshal(data, strategies); e != nil {
+		return nil, fmt.Errorf("parse sampling strategies file %s failed, err:%v", path, e)
+	}
+	if e = strategies.validate(); e != nil {
+		return nil, fmt.Errorf("invalid sampling strategies file %s, err:%v", path, e)
+	}
+	return strategies, nil
+}
+
+// ServeHTTP 实现 http.Handler
+func (h *SamplingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	services := req.URL.Query()["service"]
+	if len(services) != 1 || services[0] == "" {
+		http.Error(w, "'service' parameter must occur exactly once", http.StatusBadRequest)
+		return
+	}
+
+	data, e := json.Marshal(h.Strategy(services[0]))
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// Strategy 服务的采样策略，未单独配置的服务返回默认策略
+func (h *SamplingHandler) Strategy(service string) *sampling.SamplingStrategyResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if time.Since(h.checkedAt) >= h.interval {
+		// 加载失败时继续使用之前的策略
+		_ = h.reloadLocked()
+	}
+	if resp, ok := h.responses[service]; ok {
+		return resp
+	}
+	return h.fallback
+}
+
+func (h *SamplingHandler) reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reloadLocked()
+}
+
+func (h *SamplingHandler) reloadLocked() error {
+	h.checkedAt = time.Now()
+	info, e := os.Stat(h.path)
+	if e != nil {
+		return e
+	}
+	if h.responses != nil && info.ModTime().Equal(h.modTime) && info.Size() == h.size {
+		return nil
+	}
+	strategies, e := LoadSamplingStrategies(h.path)
+	if e != nil {
+		return e
+	}
+	h.responses, h.fallback = strategies.responses()
+	h.modTime, h.size = info.ModTime(), info.Size()
+	return nil
+}
+
+func (s *SamplingStrategies) validate() error {
+	if s.DefaultStrategy != nil {
+		if e := s.DefaultStrategy.validate(); e != nil {
+			return fmt.Errorf("default strategy: %v", e)
+		}
+	}
+	seen := make(map[string]bool, len(s.ServiceStrategies))
+	for _, strategy := range s.ServiceStrategies {
+		if strategy.Service == "" {
+			return fmt.Errorf("service strategy requires a service name")
+		}
+		if seen[strategy.Service] {
+			return fmt.Errorf("duplicate strategy for service %q", strategy.Service)
+		}
+		seen[strategy.Service] = true
+		if e := strategy.validate(); e != nil {
+			return fmt.Errorf("service %q: %v", strategy.Service, e)
+		}
+	}
+	return nil
+}
+
+func (s *SamplingStrategy) validate() error {
+	switch strings.ToLower(s.Type) {
+	case jaeger.SamplerTypeProbabilistic:
+		if s.Param < 0 || s.Param > 1 {
+			return fmt.Errorf("invalid probabilistic param %v, expecting value between 0 and 1", s.Param)
+		}
+	case jaeger.SamplerTypeRateLimiting:
+		if s.Param < 0 || s.Param > math.MaxInt16 {
+			return fmt.Errorf("invalid ratelimiting param %v, expecting value between 0 and %d", s.Param, math.MaxInt16)
+		}
+		if len(s.OperationStrategies) > 0 {
+			return fmt.Errorf("operation strategies require probabilistic type")
+		}
+	default:
+		return fmt.Errorf("unknown strategy type %q, expecting %s or %s",
+			s.Type, jaeger.SamplerTypeProbabilistic, jaeger.SamplerTypeRateLimiting)
+	}
+	for _, op := range s.OperationStrategies {
+		if op.Operation == "" {
+			return fmt.Errorf("operation strategy requires an operation name")
+		}
+		if strings.ToLower(op.Type) != jaeger.SamplerTypeProbabilistic {
+			return fmt.Errorf("operation %q: only probabilistic type is supported", op.Operation)
+		}
+		if op.Param < 0 || op.Param > 1 {
+			return fmt.Errorf("operation %q: invalid probabilistic param %v, expecting value between 0 and 1", op.Operation, op.Param)
+		}
+	}
+	return nil
+}
+
+// responses 转换为远程采样协议的响应，默认策略中的 operation 策略合并到各服务中未配置的 operation
+func (s *SamplingStrategies) responses() (map[string]*sampling.SamplingStrategyResponse, *sampling.SamplingStrategyResponse) {
+	defaultStrategy := SamplingStrategy{Type: jaeger.SamplerTypeProbabilistic, Param: defaultSamplingProbability}
+	if s.DefaultStrategy != nil {
+		defaultStrategy = *s.DefaultStrategy
+	}
+
+	responses := make(map[string]*sampling.SamplingStrategyResponse, len(s.ServiceStrategies))
+	for _, strategy := range s.ServiceStrategies {
+		responses[strategy.Service] = strategy.response(defaultStrategy.OperationStrategies)
+	}
+	return responses, defaultStrategy.response(nil)
+}
+
+func (s SamplingStrategy) response(defaultOperations []OperationSamplingStrategy) *sampling.SamplingStrategyResponse {
+	if strings.ToLower(s.Type) == jaeger.SamplerTypeRateLimiting {
+		return &sampling.SamplingStrategyResponse{
+			StrategyType:         sampling.SamplingStrategyType_RATE_LIMITING,
+			RateLimitingSampling: &sampling.RateLimitingSamplingStrategy{MaxTracesPerSecond: int16(s.Param)},
+		}
+	}
+
+	resp := &sampling.SamplingStrategyResponse{
+		StrategyType:          sampling.SamplingStrategyType_PROBABILISTIC,
+		ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{SamplingRate: s.Param},
+	}
+	operations := append([]OperationSamplingStrategy(nil), s.OperationStrategies...)
+	for _, op := range defaultOperations {
+		if !hasOperation(operations, op.Operation) {
+			operations = append(operations, op)
+		}
+	}
+	if len(operations) == 0 {
+		return resp
+	}
+	resp.OperationSampling = &sampling.PerOperationSamplingStrategies{DefaultSamplingProbability: s.Param}
+	for _, op := range operations {
+		resp.OperationSampling.PerOperationStrategies = append(resp.OperationSampling.PerOperationStrategies,
+			&sampling.OperationSamplingStrategy{
+				Operation:             op.Operation,
+				ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{SamplingRate: op.Param},
+			})
+	}
+	return resp
+}
+
+func hasOperation(operations []OperationSamplingStrategy, name string) bool {
+	for _, op := range operations {
+		if op.Operation == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package trace_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+// sampledCount 统计 n 个 span 中被采样的数量，每个 operation 的第一个 span 可能被每秒最少采样数量采中
+func sampledCount(tracer *trace.Tracer, operation string, n int) int {
+	sampled := 0
+	for i := 0; i < n; i++ {
+		span := tracer.StartSpan(operation)
+		if span.Context().(jaeger.SpanContext).IsSampled() {
+			sampled++
+		}
+		span.Finish()
+	}
+	return sampled
+}
+
+// writeStrategies 写入策略文件并推后修改时间，文件大小不变时也能被识别为修改
+func writeStrategies(t *testing.T, path, content string) {
+	modTime := time.Now()
+	if info, e := os.Stat(path); e == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if e := os.WriteFile(path, []byte(content), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.Chtimes(path, modTime, modTime); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func newFileSamplingTracer(t *testing.T, path string) *trace.Tracer {
+	tracer, e := trace.NewTracer("sampling-test", "",
+		trace.WithReporter(jaeger.NewInMemoryReporter()),
+		trace.WithReporterLogSpans(false),
+		trace.WithPerOperationSamplingFile(path, 10*time.Millisecond),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = tracer.Close() })
+	return tracer
+}
+
+func TestFileSampler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	writeStrategies(t, path, `{"operationSampling":{"defaultSamplingProbability":1,
+"perOperationStrategies":[{"operation":"/health","probabilisticSampling":{"samplingRate":0}}]}}`)
+	tracer := newFileSamplingTracer(t, path)
+
+	if n := sampledCount(tracer, "/health", 10); n > 1 {
+		t.Errorf("/health sampled %d of 10", n)
+	}
+	if n := sampledCount(tracer, "/users", 10); n != 10 {
+		t.Errorf("/users sampled %d of 10", n)
+	}
+}
+
+func TestFileSamplerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	writeStrategies(t, path, `{"defaultSamplingProbability":0}`)
+	tracer := newFileSamplingTracer(t, path)
+	if n := sampledCount(tracer, "/users", 10); n > 1 {
+		t.Fatalf("/users sampled %d of 10 before reload", n)
+	}
+
+	writeStrategies(t, path, `{"defaultSamplingProbability":1}`)
+	deadline := time.Now().Add(time.Second)
+	for sampledCount(tracer, "/users", 10) != 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("strategies not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileSamplerKeepLastGood(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	writeStrategies(t, path, `{"defaultSamplingProbability":1}`)
+	tracer := newFileSamplingTracer(t, path)
+
+	for _, content := range []string{`{"defaultSamplingProbability":2}`, `{"defaultSamplingProbability":`} {
+		writeStrategies(t, path, content)
+		time.Sleep(50 * time.Millisecond)
+		if n := sampledCount(tracer, "/users", 10); n != 10 {
+			t.Errorf("%s: sampled %d of 10, want last good strategy", content, n)
+		}
+	}
+}
+
+func TestSamplingHandlerRemote(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	writeStrategies(t, path, `{"default_strategy":{"type":"probabilistic","param":0},
+"service_strategies":[{"service":"sampling-test","type":"probabilistic","param":1,
+"operation_strategies":[{"operation":"/health","type":"probabilistic","param":0}]}]}`)
+	handler, e := trace.NewSamplingHandler(path, 0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("service") == "sampling-test" {
+			atomic.AddInt32(&requests, 1)
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	tracer, e := trace.NewTracer("sampling-test", "",
+		trace.WithReporter(jaeger.NewInMemoryReporter()),
+		trace.WithReporterLogSpans(false),
+		trace.WithSamplerType(jaeger.SamplerTypeRemote),
+		trace.WithSamplerParam(0),
+		trace.WithSamplingServerURL(server.URL+"/sampling"),
+		trace.WithSamplingRefreshInterval(10*time.Millisecond),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tracer.Close()
+
+	// 拉取到策略前使用初始采样率，之后 /users 使用服务的采样率 1
+	deadline := time.Now().Add(time.Second)
+	for sampledCount(tracer, "/users", 10) != 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("strategies not fetched from sampling handler")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&requests) == 0 {
+		t.Error("sampling handler not requested for service")
+	}
+	if n := sampledCount(tracer, "/health", 10); n > 1 {
+		t.Errorf("/health sampled %d of 10", n)
+	}
+}
@@ -0,0 +1,231 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+// Reporters 中的名称，自定义 reporter 按 WithReporter 的顺序命名为 custom-0、custom-1 ...
+const (
+	reporterStatsFile   = "file"
+	reporterStatsCustom = "custom"
+)
+
+type (
+	// ReporterStats reporter 上报统计，每个 span 只计一次
+	// 同时设置 WithReporter 和 WithFileReporter 时各 reporter 分别统计，记录在 Reporters 中，
+	// Flushed、Failed、Dropped 取尚未推送数量最多的 reporter；自定义 reporter 的 Report 返回即视为推送成功
+	ReporterStats struct {
+		Finished  int64                    // 结束的采样 span 数量
+		Flushed   int64                    // 成功推送的 span 数量
+		Failed    int64                    // 推送失败的 span 数量
+		Dropped   int64                    // 队列已满被丢弃的 span 数量
+		Filtered  int64                    // 尾部采样丢弃的 span 数量
+		Reporters map[string]ReporterStats // 各 reporter 的统计，只使用 agent、collector 或 OTLP 上报时为空
+	}
+
+	// reporterStats 只统计 reporter 相关指标的 metrics.Factory，其余指标不记录
+	reporterStats struct {
+		finished int64
+		flushed  int64
+		failed   int64
+		dropped  int64
+	}
+
+	statsCounter struct {
+		value *int64
+	}
+
+	// statsReporter 统计自定义 reporter 收到的 span
+	statsReporter struct {
+		jaeger.Reporter
+		stats *reporterStats
+	}
+)
+
+// Pending 尚未推送的 span 数量，Shutdown 超时后即为丢失的 span 数量
+func (s ReporterStats) Pending() int64 {
+	if pending := s.Finished - s.Flushed - s.Failed - s.Dropped - s.Filtered; pending > 0 {
+		return pending
+	}
+	return 0
+}
+
+func (s ReporterStats) String() string {
+	return fmt.Sprintf("finished:%d flushed:%d failed:%d dropped:%d filtered:%d pending:%d",
+		s.Finished, s.Flushed, s.Failed, s.Dropped, s.Filtered, s.Pending())
+}
+
+// Stats 当前的 reporter 上报统计
+func (t *Tracer) Stats() ReporterStats {
+	stats := t.stats.snapshot()
+	if t.tail != nil {
+		stats.Filtered = atomic.LoadInt64(&t.tail.droppedSpans)
+	}
+	if len(t.reporters) == 0 {
+		return stats
+	}
+
+	names := make([]string, 0, len(t.reporters))
+	for name := range t.reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats.Reporters = make(map[string]ReporterStats, len(names))
+	for i, name := range names {
+		s := t.reporters[name].snapshot()
+		s.Finished, s.Filtered = stats.Finished, stats.Filtered
+		stats.Reporters[name] = s
+		if i == 0 || s.Pending() > stats.Pending() {
+			stats.Flushed, stats.Failed, stats.Dropped = s.Flushed, s.Failed, s.Dropped
+		}
+	}
+	return stats
+}
+
+/*
+Shutdown 关闭追踪器并推送队列中剩余的 span
+ctx 超时或取消时不再等待，返回的错误包含 ctx.Err() 及当时的上报统计，推送在后台继续进行
+Args:
+ - ctx: 控制等待推送的截止时间
+*/
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Close()
+	}()
+
+	select {
+	case e := <-done:
+		if stats := t.Stats(); stats.Failed > 0 || stats.Dropped > 0 {
+			t.logError(fmt.Sprintf("tracer shutdown with spans lost, %s", stats))
+		}
+		return e
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown tracer: %w, %s", ctx.Err(), t.Stats())
+	}
+}
+
+// Shutdown 关闭 NewJaegerTracer 创建的追踪器并推送队列中剩余的 span，尚未创建时直接返回 nil
+func Shutdown(ctx context.Context) error {
+	globalMu.Lock()
+	t, _ := closer.(*Tracer)
+	globalMu.Unlock()
+
+	if t == nil {
+		return nil
+	}
+	return t.Shutdown(ctx)
+}
+
+/*
+ShutdownOnSignal 收到信号时调用 Shutdown 推送剩余的 span，不会重新发送该信号，也不会退出进程
+应用通过 signal.Notify 监听同一信号时会同时收到该信号，需要自行退出；Shutdown 完成前退出会丢失未推送的 span
+收到信号后即取消监听，应用未监听时再次收到该信号将执行默认行为（退出进程）
+返回的 stop 函数用于取消监听
+Args:
+ - timeout: 等待推送的最长时间
+ - signals: 监听的信号，默认为 SIGTERM 和 SIGINT
+*/
+func (t *Tracer) ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if e := t.Shutdown(ctx); e != nil {
+				t.logError(fmt.Sprintf("shutdown tracer on signal %v failed, err:%v", sig, e))
+			}
+			cancel()
+		case <-stopped:
+			signal.Stop(ch)
+		}
+	}()
+
+	var closed int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&closed, 0, 1) {
+			close(stopped)
+		}
+	}
+}
+
+func (t *Tracer) logError(msg string) {
+	if t.logger != nil {
+		t.logger.Error(msg)
+	}
+}
+
+func (s *reporterStats) snapshot() ReporterStats {
+	if s == nil {
+		return ReporterStats{}
+	}
+	return ReporterStats{
+		Finished: atomic.LoadInt64(&s.finished),
+		Flushed:  atomic.LoadInt64(&s.flushed),
+		Failed:   atomic.LoadInt64(&s.failed),
+		Dropped:  atomic.LoadInt64(&s.dropped),
+	}
+}
+
+// Counter 实现 metrics.Factory，对应 jaeger.Metrics 中的 finished_spans 及 reporter_spans
+func (s *reporterStats) Counter(metric metrics.Options) metrics.Counter {
+	switch {
+	case metric.Name == "finished_spans" && metric.Tags["sampled"] == "y":
+		return statsCounter{value: &s.finished}
+	case metric.Name == "reporter_spans" && metric.Tags["result"] == "ok":
+		return statsCounter{value: &s.flushed}
+	case metric.Name == "reporter_spans" && metric.Tags["result"] == "err":
+		return statsCounter{value: &s.failed}
+	case metric.Name == "reporter_spans" && metric.Tags["result"] == "dropped":
+		return statsCounter{value: &s.dropped}
+	}
+	return metrics.NullCounter
+}
+
+// Timer 实现 metrics.Factory
+func (s *reporterStats) Timer(metrics.TimerOptions) metrics.Timer {
+	return metrics.NullTimer
+}
+
+// Gauge 实现 metrics.Factory
+func (s *reporterStats) Gauge(metrics.Options) metrics.Gauge {
+	return metrics.NullGauge
+}
+
+// Histogram 实现 metrics.Factory
+func (s *reporterStats) Histogram(metrics.HistogramOptions) metrics.Histogram {
+	return metrics.NullHistogram
+}
+
+// Namespace 实现 metrics.Factory，统计时忽略命名空间
+func (s *reporterStats) Namespace(metrics.NSOptions) metrics.Factory {
+	return s
+}
+
+// Report 实现 jaeger.Reporter
+func (r statsReporter) Report(span *jaeger.Span) {
+	r.Reporter.Report(span)
+	atomic.AddInt64(&r.stats.flushed, 1)
+}
+
+// Inc 实现 metrics.Counter
+func (c statsCounter) Inc(delta int64) {
+	atomic.AddInt64(c.value, delta)
+}
@@ -0,0 +1,120 @@
+package trace_test
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-lib/metrics/metricstest"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+func TestReporterStatsRecorder(t *testing.T) {
+	recorder := tracetest.NewRecorder(t)
+	recorder.StartSpan("a").Finish()
+	recorder.StartSpan("b").Finish()
+
+	stats := recorder.Stats()
+	if stats.Finished != 2 || stats.Flushed != 2 || stats.Pending() != 0 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestReporterStatsMultipleReporters(t *testing.T) {
+	tracer, e := trace.NewTracer("stats-test", "",
+		trace.WithReporter(jaeger.NewInMemoryReporter(), jaeger.NewInMemoryReporter()),
+		trace.WithFileReporter(filepath.Join(t.TempDir(), "spans.jsonl")),
+		trace.WithReporterLogSpans(false),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 3; i++ {
+		tracer.StartSpan("span").Finish()
+	}
+	if e := tracer.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	stats := tracer.Stats()
+	if stats.Finished != 3 || stats.Flushed != 3 || stats.Pending() != 0 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+	for _, name := range []string{"custom-0", "custom-1", "file"} {
+		if s, ok := stats.Reporters[name]; !ok || s.Flushed != 3 || s.Pending() != 0 {
+			t.Errorf("reporter %s: unexpected stats: %s", name, s)
+		}
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer, e := trace.NewTracer("stats-test", "",
+		trace.WithFileReporter(path),
+		trace.WithReporterLogSpans(false),
+		trace.WithBufferFlushInterval(time.Hour),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 先注册应用自己的监听，避免 SIGHUP 执行默认行为
+	app := make(chan os.Signal, 2)
+	signal.Notify(app, syscall.SIGHUP)
+	defer signal.Stop(app)
+	stop := tracer.ShutdownOnSignal(time.Second, syscall.SIGHUP)
+	defer stop()
+
+	tracer.StartSpan("span").Finish()
+	p, _ := os.FindProcess(os.Getpid())
+	if e := p.Signal(syscall.SIGHUP); e != nil {
+		t.Skipf("send signal, err:%v", e)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for tracer.Stats().Flushed != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := tracer.Stats(); stats.Flushed != 1 {
+		t.Errorf("tracer not shut down: %s", stats)
+	}
+	// 应用只收到一次信号，没有被重新发送
+	<-app
+	select {
+	case sig := <-app:
+		t.Errorf("signal %v delivered twice", sig)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMetricsFactory(t *testing.T) {
+	factory := metricstest.NewFactory(0)
+	defer factory.Stop()
+	tracer, e := trace.NewTracer("stats-test", "",
+		trace.WithReporter(jaeger.NewInMemoryReporter()),
+		trace.WithReporterLogSpans(false),
+		trace.WithMetricsFactory(factory),
+		trace.WithRPCMetrics(true),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tracer.StartSpan("get", ext.SpanKindRPCServer).Finish()
+	_ = tracer.Close()
+
+	factory.AssertCounterMetrics(t,
+		metricstest.ExpectedMetric{Name: "jaeger.tracer.finished_spans", Tags: map[string]string{"sampled": "y"}, Value: 1},
+		metricstest.ExpectedMetric{Name: "jaeger-rpc.requests",
+			Tags: map[string]string{"component": "jaeger", "endpoint": "get", "error": "false"}, Value: 1},
+	)
+	// 同时仍统计到 Tracer.Stats
+	if stats := tracer.Stats(); stats.Finished != 1 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
@@ -0,0 +1,308 @@
+package trace
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	tailSamplingDefaultMaxSpans = 50000
+	tailSamplingMinTick         = 10 * time.Millisecond
+	tailSamplingMaxRandomNumber = ^(uint64(1) << 63)
+)
+
+type (
+	// TailSamplingStats 尾部采样统计
+	TailSamplingStats struct {
+		BufferedTraces int64 // 当前缓存的 trace 数量
+		BufferedSpans  int64 // 当前缓存的 span 数量
+		Kept           int64 // 包含错误或慢 span 而保留的 trace 数量
+		Sampled        int64 // 按基础采样率保留的 trace 数量
+		Dropped        int64 // 丢弃的 trace 数量
+		DroppedSpans   int64 // 丢弃的 span 数量
+		Evicted        int64 // 缓存超过上限，提前判定的 trace 数量
+		LateSpans      int64 // trace 判定后才到达的 span 数量，按已有判定上报或丢弃
+	}
+
+	// tailSamplingReporter 按 trace id 缓存 span，从第一个 span 结束起等待 window 后判定：
+	// 任一 span 带 error=true 或耗时超过 latency 时保留，否则按 baseRate 采样
+	// 判定结果按 LRU 记录最近 maxSpans 个 trace，判定后才到达的 span 沿用已有判定
+	tailSamplingReporter struct {
+		reporter jaeger.Reporter
+		window   time.Duration
+		latency  time.Duration
+		boundary uint64
+		maxSpans int
+
+		mu     sync.Mutex
+		traces map[jaeger.TraceID]*tailTrace
+		order  *list.List // *tailTrace，按第一个 span 结束的时间排序
+		spans  int
+
+		decided      map[jaeger.TraceID]*list.Element
+		decidedOrder *list.List // *tailDecision，最近判定的在后
+
+		kept         int64
+		sampled      int64
+		dropped      int64
+		droppedSpans int64
+		evicted      int64
+		lateSpans    int64
+
+		closeOnce sync.Once
+		closed    chan struct{}
+		done      chan struct{}
+	}
+
+	tailTrace struct {
+		id          jaeger.TraceID
+		spans       []*jaeger.Span
+		deadline    time.Time
+		interesting bool
+		keep        bool
+		elem        *list.Element
+	}
+
+	tailDecision struct {
+		id   jaeger.TraceID
+		keep bool
+	}
+)
+
+/*
+WithTailSampling 设置 尾部采样，span 按 trace 缓存 window 时长后再决定是否上报
+trace 中任一 span 带 error=true 或耗时不小于 latency 时上报，其余 trace 按 baseRate 采样
+需要配合全量头部采样使用，例如默认的 const 采样器，否则未被头部采样的 trace 不会进入缓存
+判定后才结束的 span 沿用该 trace 的判定结果，不再缓存
+Args:
+ - window: 缓存时长，从 trace 中第一个 span 结束开始计算
+ - latency: 慢 span 阈值，为 0 时不按耗时保留
+ - baseRate: 其余 trace 的采样率，0 到 1 之间
+*/
+func WithTailSampling(window, latency time.Duration, baseRate float64) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.tailSamplingWindow = window
+		opts.tailSamplingLatency = latency
+		opts.tailSamplingBaseRate = baseRate
+	}
+}
+
+// WithTailSamplingMaxSpans 设置 尾部采样最多缓存的 span 数量，超过时最早的 trace 提前判定，默认 50000
+func WithTailSamplingMaxSpans(maxSpans int) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.tailSamplingMaxSpans = maxSpans
+	}
+}
+
+// TailSamplingStats 尾部采样统计，未开启尾部采样时返回零值
+func (t *Tracer) TailSamplingStats() TailSamplingStats {
+	if t.tail == nil {
+		return TailSamplingStats{}
+	}
+	return t.tail.stats()
+}
+
+// validateTailSampling 校验尾部采样配置，window 为 0 表示未开启
+func (o *jaegerTracerOptions) validateTailSampling() error {
+	if o.tailSamplingWindow < 0 {
+		return errors.New("tail sampling window cannot be negative")
+	}
+	if o.tailSamplingWindow == 0 {
+		return nil
+	}
+	if o.tailSamplingLatency < 0 {
+		return errors.New("tail sampling latency cannot be negative")
+	}
+	if o.tailSamplingBaseRate < 0 || o.tailSamplingBaseRate > 1 {
+		return fmt.Errorf("invalid tail sampling base rate %v, expecting value between 0 and 1", o.tailSamplingBaseRate)
+	}
+	if o.tailSamplingMaxSpans < 0 {
+		return errors.New("tail sampling max spans cannot be negative")
+	}
+	return nil
+}
+
+func newTailSamplingReporter(reporter jaeger.Reporter, window, latency time.Duration, baseRate float64,
+	maxSpans int) *tailSamplingReporter {
+	if maxSpans <= 0 {
+		maxSpans = tailSamplingDefaultMaxSpans
+	}
+	r := &tailSamplingReporter{
+		reporter:     reporter,
+		window:       window,
+		latency:      latency,
+		boundary:     uint64(float64(tailSamplingMaxRandomNumber) * baseRate),
+		maxSpans:     maxSpans,
+		traces:       make(map[jaeger.TraceID]*tailTrace),
+		order:        list.New(),
+		decided:      make(map[jaeger.TraceID]*list.Element),
+		decidedOrder: list.New(),
+		closed:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go r.processExpired()
+	return r
+}
+
+// Report 实现 jaeger.Reporter
+func (r *tailSamplingReporter) Report(span *jaeger.Span) {
+	id := span.SpanContext().TraceID()
+
+	r.mu.Lock()
+	if elem, ok := r.decided[id]; ok {
+		r.decidedOrder.MoveToBack(elem)
+		keep := elem.Value.(*tailDecision).keep
+		r.mu.Unlock()
+
+		atomic.AddInt64(&r.lateSpans, 1)
+		if keep {
+			r.reporter.Report(span)
+		} else {
+			atomic.AddInt64(&r.droppedSpans, 1)
+		}
+		return
+	}
+	trace, ok := r.traces[id]
+	if !ok {
+		trace = &tailTrace{id: id, deadline: time.Now().Add(r.window)}
+		trace.elem = r.order.PushBack(trace)
+		r.traces[id] = trace
+	}
+	trace.spans = append(trace.spans, span.Retain())
+	trace.interesting = trace.interesting || r.isInteresting(span)
+	r.spans++
+
+	var evicted []*tailTrace
+	for r.spans > r.maxSpans && r.order.Len() > 0 {
+		evicted = append(evicted, r.remove(r.order.Front().Value.(*tailTrace)))
+	}
+	r.mu.Unlock()
+
+	atomic.AddInt64(&r.evicted, int64(len(evicted)))
+	for _, t := range evicted {
+		r.decide(t)
+	}
+}
+
+// Close 实现 jaeger.Reporter，判定全部缓存的 trace 后关闭内部 reporter
+func (r *tailSamplingReporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		<-r.done
+
+		r.mu.Lock()
+		var remaining []*tailTrace
+		for r.order.Len() > 0 {
+			remaining = append(remaining, r.remove(r.order.Front().Value.(*tailTrace)))
+		}
+		r.mu.Unlock()
+
+		for _, t := range remaining {
+			r.decide(t)
+		}
+		r.reporter.Close()
+	})
+}
+
+func (r *tailSamplingReporter) processExpired() {
+	defer close(r.done)
+
+	tick := r.window / 10
+	if tick < tailSamplingMinTick {
+		tick = tailSamplingMinTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.mu.Lock()
+			var expired []*tailTrace
+			for r.order.Len() > 0 {
+				t := r.order.Front().Value.(*tailTrace)
+				if t.deadline.After(now) {
+					break
+				}
+				expired = append(expired, r.remove(t))
+			}
+			r.mu.Unlock()
+
+			for _, t := range expired {
+				r.decide(t)
+			}
+		case <-r.closed:
+			return
+		}
+	}
+}
+
+// remove 从缓存中移除 trace 并记录判定结果，需要持有锁
+func (r *tailSamplingReporter) remove(t *tailTrace) *tailTrace {
+	r.order.Remove(t.elem)
+	delete(r.traces, t.id)
+	r.spans -= len(t.spans)
+
+	t.keep = t.interesting || t.id.Low&tailSamplingMaxRandomNumber < r.boundary
+	r.decided[t.id] = r.decidedOrder.PushBack(&tailDecision{id: t.id, keep: t.keep})
+	for r.decidedOrder.Len() > r.maxSpans {
+		delete(r.decided, r.decidedOrder.Remove(r.decidedOrder.Front()).(*tailDecision).id)
+	}
+	return t
+}
+
+// decide 按 remove 记录的判定结果上报或丢弃 trace 中的 span
+func (r *tailSamplingReporter) decide(t *tailTrace) {
+	switch {
+	case t.interesting:
+		atomic.AddInt64(&r.kept, 1)
+	case t.keep:
+		atomic.AddInt64(&r.sampled, 1)
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+		atomic.AddInt64(&r.droppedSpans, int64(len(t.spans)))
+	}
+	for _, span := range t.spans {
+		if t.keep {
+			r.reporter.Report(span)
+		}
+		span.Release()
+	}
+}
+
+func (r *tailSamplingReporter) isInteresting(span *jaeger.Span) bool {
+	if r.latency > 0 && span.Duration() >= r.latency {
+		return true
+	}
+	switch v := span.Tags()[string(ext.Error)].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (r *tailSamplingReporter) stats() TailSamplingStats {
+	r.mu.Lock()
+	traces, spans := len(r.traces), r.spans
+	r.mu.Unlock()
+
+	return TailSamplingStats{
+		BufferedTraces: int64(traces),
+		BufferedSpans:  int64(spans),
+		Kept:           atomic.LoadInt64(&r.kept),
+		Sampled:        atomic.LoadInt64(&r.sampled),
+		Dropped:        atomic.LoadInt64(&r.dropped),
+		DroppedSpans:   atomic.LoadInt64(&r.droppedSpans),
+		Evicted:        atomic.LoadInt64(&r.evicted),
+		LateSpans:      atomic.LoadInt64(&r.lateSpans),
+	}
+}
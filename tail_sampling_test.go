@@ -0,0 +1,120 @@
+package trace_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+func newTailSamplingTracer(t *testing.T, window, latency time.Duration, baseRate float64) (*trace.Tracer, *jaeger.InMemoryReporter) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, e := trace.NewTracer("tail-test", "",
+		trace.WithReporter(reporter),
+		trace.WithReporterLogSpans(false),
+		trace.WithTailSampling(window, latency, baseRate),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = tracer.Close() })
+	return tracer, reporter
+}
+
+// waitTailDecided 等待缓存的 trace 全部判定，InMemoryReporter 关闭时会清空 span，不能通过 Close 判定
+func waitTailDecided(t *testing.T, tracer *trace.Tracer) trace.TailSamplingStats {
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := tracer.TailSamplingStats()
+		if stats.BufferedTraces == 0 || time.Now().After(deadline) {
+			return stats
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTailSamplingKeepError(t *testing.T) {
+	tracer, reporter := newTailSamplingTracer(t, 20*time.Millisecond, 0, 0)
+
+	root := tracer.StartSpan("root")
+	child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+	ext.Error.Set(child, true)
+	child.Finish()
+	root.Finish()
+	tracer.StartSpan("ok").Finish()
+	stats := waitTailDecided(t, tracer)
+	if stats.Kept != 1 || stats.Dropped != 1 || stats.DroppedSpans != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if n := reporter.SpansSubmitted(); n != 2 {
+		t.Errorf("reported %d spans, want 2", n)
+	}
+}
+
+func TestTailSamplingKeepLatency(t *testing.T) {
+	tracer, reporter := newTailSamplingTracer(t, 20*time.Millisecond, 100*time.Millisecond, 0)
+
+	tracer.StartSpan("slow", opentracing.StartTime(time.Now().Add(-time.Second))).Finish()
+	tracer.StartSpan("fast").Finish()
+	stats := waitTailDecided(t, tracer)
+	if stats.Kept != 1 || stats.Dropped != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if spans := reporter.GetSpans(); len(spans) != 1 || spans[0].(*jaeger.Span).OperationName() != "slow" {
+		t.Errorf("reported spans: %v", spans)
+	}
+}
+
+func TestTailSamplingBaseRate(t *testing.T) {
+	cases := map[string]struct {
+		baseRate float64
+		sampled  int64
+		dropped  int64
+	}{
+		"drop all":   {baseRate: 0, dropped: 10},
+		"sample all": {baseRate: 1, sampled: 10},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tracer, reporter := newTailSamplingTracer(t, 20*time.Millisecond, 0, c.baseRate)
+			for i := 0; i < 10; i++ {
+				tracer.StartSpan("span").Finish()
+			}
+			stats := waitTailDecided(t, tracer)
+			if stats.Sampled != c.sampled || stats.Dropped != c.dropped || stats.Kept != 0 {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+			if n := int64(reporter.SpansSubmitted()); n != c.sampled {
+				t.Errorf("reported %d spans, want %d", n, c.sampled)
+			}
+		})
+	}
+}
+
+func TestTailSamplingLateSpan(t *testing.T) {
+	tracer, reporter := newTailSamplingTracer(t, 20*time.Millisecond, 0, 0)
+
+	kept := tracer.StartSpan("kept")
+	keptChild := tracer.StartSpan("kept child", opentracing.ChildOf(kept.Context()))
+	ext.Error.Set(keptChild, true)
+	keptChild.Finish()
+	dropped := tracer.StartSpan("dropped")
+	tracer.StartSpan("dropped child", opentracing.ChildOf(dropped.Context())).Finish()
+	if stats := waitTailDecided(t, tracer); stats.BufferedTraces != 0 {
+		t.Fatalf("traces not decided: %+v", stats)
+	}
+
+	kept.Finish()
+	dropped.Finish()
+	stats := tracer.TailSamplingStats()
+	if stats.LateSpans != 2 || stats.BufferedTraces != 0 || stats.DroppedSpans != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if n := reporter.SpansSubmitted(); n != 2 {
+		t.Errorf("reported %d spans, want 2", n)
+	}
+}
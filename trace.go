@@ -1,19 +1,28 @@
 package trace
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/uber/jaeger-client-go"
 	jaegerConfig "github.com/uber/jaeger-client-go/config"
+	"github.com/uber/jaeger-client-go/thrift-gen/sampling"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/jaeger-lib/metrics/multi"
 )
 
 var tracer opentracing.Tracer
 var closer io.Closer
 var err error
 var once sync.Once
+var globalMu sync.Mutex
 
 type (
 	Option func(opts *jaegerTracerOptions)
@@ -21,67 +30,238 @@ type (
 	jaegerTracerOptions struct {
 		log     bool
 		disable bool
+		global  bool
 
-		reporterCollectorEndpoint   string
-		reporterQueueSize           int
-		reporterLogSpans            bool
-		reporterBufferFlushInterval time.Duration
+		rpcMetrics     bool
+		metricsFactory metrics.Factory
+		tags           []opentracing.Tag
 
-		samplerType  string
-		samplerParam float64
+		reporterCollectorEndpoint          string
+		reporterQueueSize                  int
+		reporterLogSpans                   bool
+		reporterBufferFlushInterval        time.Duration
+		reporterDisableAttemptReconnecting bool
+		reporterAttemptReconnectInterval   time.Duration
+		reporterUser                       string
+		reporterPassword                   string
+		reporterHTTPHeaders                map[string]string
+		reporterOTLPEndpoint               string
+		reporterOTLPProtocol               string
+		reporterOTLPHeaders                map[string]string
+		reporterOTLPCompression            string
+		reporterFilePath                   string
+		reporterFileMaxSize                int64
+		reporterFileMaxBackups             int
+		reporters                          []jaeger.Reporter
+		propagations                       []Propagation
+		tailSamplingWindow                 time.Duration
+		tailSamplingLatency                time.Duration
+		tailSamplingBaseRate               float64
+		tailSamplingMaxSpans               int
+
+		samplerType                     string
+		samplerParam                    float64
+		samplerSamplingServerURL        string
+		samplerSamplingRefreshInterval  time.Duration
+		samplerMaxOperations            int
+		samplerOperationNameLateBinding bool
+		samplerOptions                  []jaeger.SamplerOption
+		samplingStrategies              *sampling.PerOperationSamplingStrategies
+		samplingStrategiesFile          string
+		samplingReloadInterval          time.Duration
+
+		headers             *jaeger.HeadersConfig
+		baggageRestrictions *jaegerConfig.BaggageRestrictionsConfig
+		throttler           *jaegerConfig.ThrottlerConfig
 	}
 )
 
+// Tracer Jaeger 链路追踪器句柄，可以多次创建，各实例之间互不影响
+type Tracer struct {
+	opentracing.Tracer
+
+	serviceName string
+	closer      io.Closer
+	logger      jaeger.Logger
+	stats       *reporterStats
+	reporters   map[string]*reporterStats
+	tail        *tailSamplingReporter
+	closeOnce   sync.Once
+	closeErr    error
+}
+
 /*
-NewJaegerTracer 创建 Jaeger 链路追踪器
+NewJaegerTracer 创建 Jaeger 链路追踪器，并设置为全局追踪器
+只有第一次调用生效，之后的调用都返回第一次创建的追踪器；需要多个追踪器时请使用 NewTracer
 Args:
  - jaegerHostPort: jaeger agent 组件 IP 地址 及 端口. 例如："127.0.0.1:6831"
  - serviceName: 服务名称
 */
 func NewJaegerTracer(serviceName string, jaegerHostPort string, opts ...Option) (opentracing.Tracer, io.Closer, error) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
 	once.Do(func() {
-		options := buildOptions(opts...)
-		cfg := &jaegerConfig.Configuration{
-			ServiceName: serviceName,
-			Disabled:    options.disable,
-			RPCMetrics:  false,
-			Tags:        nil,
-			Sampler: &jaegerConfig.SamplerConfig{
-				Type:                     options.samplerType,
-				Param:                    options.samplerParam,
-				MaxOperations:            0,
-				OperationNameLateBinding: false,
-				Options:                  nil,
-			},
-			Reporter: &jaegerConfig.ReporterConfig{
-				QueueSize:                  options.reporterQueueSize,
-				BufferFlushInterval:        options.reporterBufferFlushInterval,
-				LogSpans:                   options.reporterLogSpans,
-				LocalAgentHostPort:         jaegerHostPort,
-				DisableAttemptReconnecting: false,
-				AttemptReconnectInterval:   0,
-				CollectorEndpoint:          options.reporterCollectorEndpoint,
-				User:                       "",
-				Password:                   "",
-				HTTPHeaders:                nil,
-			},
-			Headers:             nil,
-			BaggageRestrictions: nil,
-			Throttler:           nil,
-		}
-
-		if options.log {
-			tracer, closer, err = cfg.NewTracer(jaegerConfig.Logger(jaeger.StdLogger))
-		} else {
-			tracer, closer, err = cfg.NewTracer()
-		}
+		var t *Tracer
+		t, err = NewTracer(serviceName, jaegerHostPort, append(opts, WithGlobal(true))...)
 		if err == nil {
-			opentracing.SetGlobalTracer(tracer)
+			tracer, closer = t.Tracer, t
 		}
 	})
 	return tracer, closer, err
 }
 
+/*
+NewTracer 创建独立的 Jaeger 链路追踪器，可以多次调用
+默认不会设置为全局追踪器，需要时传入 WithGlobal(true) 或调用 Tracer.SetGlobal
+Args:
+ - jaegerHostPort: jaeger agent 组件 IP 地址 及 端口. 例如："127.0.0.1:6831"
+ - serviceName: 服务名称
+*/
+func NewTracer(serviceName string, jaegerHostPort string, opts ...Option) (*Tracer, error) {
+	options := buildOptions(opts...)
+	if e := options.validate(); e != nil {
+		return nil, e
+	}
+	cfg := &jaegerConfig.Configuration{
+		ServiceName: serviceName,
+		Disabled:    options.disable,
+		RPCMetrics:  options.rpcMetrics,
+		Tags:        options.tags,
+		Sampler: &jaegerConfig.SamplerConfig{
+			Type:                     options.samplerType,
+			Param:                    options.samplerParam,
+			SamplingServerURL:        options.samplerSamplingServerURL,
+			SamplingRefreshInterval:  options.samplerSamplingRefreshInterval,
+			MaxOperations:            options.samplerMaxOperations,
+			OperationNameLateBinding: options.samplerOperationNameLateBinding,
+			Options:                  options.samplerOptions,
+		},
+		Reporter: &jaegerConfig.ReporterConfig{
+			QueueSize:                  options.reporterQueueSize,
+			BufferFlushInterval:        options.reporterBufferFlushInterval,
+			LogSpans:                   options.reporterLogSpans,
+			LocalAgentHostPort:         jaegerHostPort,
+			DisableAttemptReconnecting: options.reporterDisableAttemptReconnecting,
+			AttemptReconnectInterval:   options.reporterAttemptReconnectInterval,
+			CollectorEndpoint:          options.reporterCollectorEndpoint,
+			User:                       options.reporterUser,
+			Password:                   options.reporterPassword,
+			HTTPHeaders:                options.reporterHTTPHeaders,
+		},
+		Headers:             options.headers,
+		BaggageRestrictions: options.baggageRestrictions,
+		Throttler:           options.throttler,
+	}
+
+	var (
+		t       = &Tracer{serviceName: serviceName, stats: &reporterStats{}}
+		factory = metrics.Factory(t.stats)
+		e       error
+	)
+	if options.metricsFactory != nil {
+		factory = multi.New(t.stats, options.metricsFactory)
+	}
+	cfgOpts := []jaegerConfig.Option{jaegerConfig.Metrics(factory)}
+	if options.log {
+		t.logger = jaeger.StdLogger
+		cfgOpts = append(cfgOpts, jaegerConfig.Logger(t.logger))
+	}
+	if options.reporterOTLPEndpoint != "" && !options.disable {
+		if t.Tracer, t.closer, e = options.newOTelTracer(serviceName, t.stats, t.logger); e != nil {
+			return nil, e
+		}
+		if options.global {
+			t.SetGlobal()
+		}
+		return t, nil
+	}
+	jaegerMetrics := jaeger.NewMetrics(factory, nil)
+	if httpHeaders, textMap := options.newPropagators(jaegerMetrics); httpHeaders != nil {
+		cfgOpts = append(cfgOpts,
+			jaegerConfig.Injector(opentracing.HTTPHeaders, httpHeaders),
+			jaegerConfig.Extractor(opentracing.HTTPHeaders, httpHeaders),
+			jaegerConfig.Injector(opentracing.TextMap, textMap),
+			jaegerConfig.Extractor(opentracing.TextMap, textMap),
+		)
+	}
+	sampler, e := options.newSampler(t.logger)
+	if e != nil {
+		return nil, e
+	}
+	if sampler != nil {
+		cfgOpts = append(cfgOpts, jaegerConfig.Sampler(sampler))
+	}
+	reporter, e := options.newReporter(serviceName, t.logger, t)
+	if e == nil && reporter == nil && options.tailSamplingWindow > 0 && !options.disable {
+		reporter, e = cfg.Reporter.NewReporter(serviceName, jaegerMetrics, t.logger)
+	}
+	if e != nil {
+		if sampler != nil {
+			sampler.Close()
+		}
+		return nil, e
+	}
+	if reporter != nil && options.tailSamplingWindow > 0 {
+		t.tail = newTailSamplingReporter(reporter, options.tailSamplingWindow, options.tailSamplingLatency,
+			options.tailSamplingBaseRate, options.tailSamplingMaxSpans)
+		reporter = t.tail
+	}
+	if reporter != nil {
+		cfgOpts = append(cfgOpts, jaegerConfig.Reporter(reporter))
+	}
+	t.Tracer, t.closer, e = cfg.NewTracer(cfgOpts...)
+	if e != nil {
+		if sampler != nil {
+			sampler.Close()
+		}
+		if reporter != nil {
+			reporter.Close()
+		}
+		return nil, e
+	}
+	if options.global {
+		t.SetGlobal()
+	}
+	return t, nil
+}
+
+// ServiceName 服务名称
+func (t *Tracer) ServiceName() string {
+	return t.serviceName
+}
+
+// SetGlobal 设置为 opentracing 全局追踪器，mid 下的中间件都使用全局追踪器
+func (t *Tracer) SetGlobal() {
+	opentracing.SetGlobalTracer(t.Tracer)
+}
+
+// Close 关闭追踪器，推送队列中剩余的 span，多次调用只关闭一次
+func (t *Tracer) Close() error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.closer.Close()
+	})
+	return t.closeErr
+}
+
+// ResetGlobalTracer 重置全局追踪器为 NoopTracer，之后可以再次调用 NewJaegerTracer，主要用于测试
+// 不会关闭之前创建的追踪器，由调用方自行 Close
+func ResetGlobalTracer() {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	once = sync.Once{}
+	tracer, closer, err = nil, nil, nil
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+}
+
+// WithGlobal 是否设置为全局追踪器
+func WithGlobal(global bool) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.global = global
+	}
+}
+
 // WithDisable 是否启动
 func WithDisable(disable bool) Option {
 	return func(opts *jaegerTracerOptions) {
@@ -128,7 +308,7 @@ func WithSamplerType(samplerType string) Option {
 	}
 }
 
-// WithSamplerParam 设置 采样率 0 - 1
+// WithSamplerParam 设置 采样率 0 - 1，"const" 采样方式只能为 0 或 1，其他值在创建追踪器时返回错误
 func WithSamplerParam(samplerParam float64) Option {
 	return func(opts *jaegerTracerOptions) {
 		if samplerParam >= 0 {
@@ -154,6 +334,190 @@ func WithCollectorEndpoint(collectorEndpoint string) Option {
 	}
 }
 
+// WithOTLPEndpoint 设置 OTLP 上报地址
+// OTLP/HTTP 例如："http://127.0.0.1:4318/v1/traces"；OTLP/gRPC 例如："127.0.0.1:4317"，"https://" 开头时使用 TLS
+// 设置后改用 OpenTelemetry SDK 创建 span，通过 OpenTracing 桥接返回追踪器，mid 下的中间件无需改动；不再发送到 agent 或 collector
+// 跨进程传递使用 W3C Trace Context 和 W3C Baggage，采样只支持 const 和 probabilistic，不能与文件、自定义 reporter 及尾部采样同时使用
+// 批量发送和失败重试沿用 WithReporterQueueSize 和 WithBufferFlushInterval 的设置
+func WithOTLPEndpoint(endpoint string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if endpoint != "" {
+			opts.reporterOTLPEndpoint = endpoint
+		}
+	}
+}
+
+// WithOTLPProtocol 设置 OTLP 传输协议
+// "http/protobuf"	默认，OTLP/HTTP protobuf 编码
+// "grpc"			OTLP/gRPC
+func WithOTLPProtocol(protocol string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if protocol != "" {
+			opts.reporterOTLPProtocol = protocol
+		}
+	}
+}
+
+// WithOTLPHeaders 设置 OTLP 上报时附加的 header，gRPC 时作为 metadata 发送，可多次调用累加
+func WithOTLPHeaders(headers map[string]string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if opts.reporterOTLPHeaders == nil {
+			opts.reporterOTLPHeaders = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			opts.reporterOTLPHeaders[k] = v
+		}
+	}
+}
+
+// WithOTLPCompression 设置 OTLP 上报的压缩方式："none" 或 "gzip"，默认不压缩
+func WithOTLPCompression(compression string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if compression != "" {
+			opts.reporterOTLPCompression = compression
+		}
+	}
+}
+
+// WithFileReporter 设置 把 span 以 JSON lines 格式追加写入本地文件，每行一个 span，适用于无法连接 agent 的环境
+// 设置后不再发送到 agent 或 collector，不能与 WithOTLPEndpoint 同时使用；写入的文件可以通过 ReadSpanRecordsFile 重新读取
+func WithFileReporter(path string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if path != "" {
+			opts.reporterFilePath = path
+		}
+	}
+}
+
+// WithFileReporterRotation 设置 文件 reporter 按大小轮转，单个文件超过 maxSize 字节后重命名为 path.1、path.2 ...
+// 最多保留 maxBackups 个旧文件；maxSize 为 0 时不轮转
+func WithFileReporterRotation(maxSize int64, maxBackups int) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.reporterFileMaxSize = maxSize
+		opts.reporterFileMaxBackups = maxBackups
+	}
+}
+
+// WithReporter 设置 自定义 reporter，例如 jaeger.NewInMemoryReporter()，可多次调用累加
+// 设置后不再发送到 agent 或 collector，可与 WithFileReporter 同时使用，不能与 WithOTLPEndpoint 同时使用
+func WithReporter(reporters ...jaeger.Reporter) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.reporters = append(opts.reporters, reporters...)
+	}
+}
+
+// WithRPCMetrics 设置 是否按 operation 生成 RPC 请求数、错误数及耗时指标，需要配合 WithMetricsFactory 使用，否则指标被丢弃
+func WithRPCMetrics(rpcMetrics bool) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.rpcMetrics = rpcMetrics
+	}
+}
+
+// WithMetricsFactory 设置 jaeger 客户端及 RPC 指标的 metrics factory，例如 jaeger-lib 的 prometheus.New()
+// 同时仍会统计 Tracer.Stats，不能与 WithOTLPEndpoint 同时使用
+func WithMetricsFactory(factory metrics.Factory) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.metricsFactory = factory
+	}
+}
+
+// WithTags 设置 进程级别的 tag，会附加到该追踪器上报的所有 span 上，可多次调用累加
+func WithTags(tags ...opentracing.Tag) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.tags = append(opts.tags, tags...)
+	}
+}
+
+// WithDisableAttemptReconnecting 设置 是否关闭 agent 地址的定期重新解析及重连，只对 agent 上报生效
+func WithDisableAttemptReconnecting(disable bool) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.reporterDisableAttemptReconnecting = disable
+	}
+}
+
+// WithAttemptReconnectInterval 设置 重新解析 agent 地址的间隔，只在未关闭重连时生效
+func WithAttemptReconnectInterval(interval time.Duration) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.reporterAttemptReconnectInterval = interval
+	}
+}
+
+// WithCollectorBasicAuth 设置 上报 collector 时使用的 http basic auth 用户名和密码，需配合 WithCollectorEndpoint 使用
+func WithCollectorBasicAuth(user, password string) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.reporterUser = user
+		opts.reporterPassword = password
+	}
+}
+
+// WithCollectorHTTPHeaders 设置 上报 collector 时附加的 http header，需配合 WithCollectorEndpoint 使用，可多次调用累加
+func WithCollectorHTTPHeaders(headers map[string]string) Option {
+	return func(opts *jaegerTracerOptions) {
+		if opts.reporterHTTPHeaders == nil {
+			opts.reporterHTTPHeaders = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			opts.reporterHTTPHeaders[k] = v
+		}
+	}
+}
+
+// WithSamplingServerURL 设置 "remote" 采样方式拉取采样策略的地址，例如："http://127.0.0.1:5778/sampling"
+func WithSamplingServerURL(samplingServerURL string) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplerSamplingServerURL = samplingServerURL
+	}
+}
+
+// WithSamplingRefreshInterval 设置 "remote" 采样方式拉取采样策略的间隔
+func WithSamplingRefreshInterval(interval time.Duration) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplerSamplingRefreshInterval = interval
+	}
+}
+
+// WithSamplerMaxOperations 设置 按 operation 采样时最多跟踪的 operation 数量，超出的使用默认概率采样
+func WithSamplerMaxOperations(maxOperations int) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplerMaxOperations = maxOperations
+	}
+}
+
+// WithSamplerOperationNameLateBinding 设置 按 operation 采样时是否允许 span 创建后再通过 SetOperationName 决定采样
+func WithSamplerOperationNameLateBinding(lateBinding bool) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplerOperationNameLateBinding = lateBinding
+	}
+}
+
+// WithSamplerOptions 设置 "remote" 采样器的其他选项
+func WithSamplerOptions(samplerOptions ...jaeger.SamplerOption) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.samplerOptions = append(opts.samplerOptions, samplerOptions...)
+	}
+}
+
+// WithHeaders 设置 传递链路信息使用的 header 名称，未设置的字段使用 jaeger 默认值
+func WithHeaders(headers *jaeger.HeadersConfig) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.headers = headers
+	}
+}
+
+// WithBaggageRestrictions 设置 baggage 白名单管理，从 agent 拉取允许写入的 baggage key
+func WithBaggageRestrictions(baggageRestrictions *jaegerConfig.BaggageRestrictionsConfig) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.baggageRestrictions = baggageRestrictions
+	}
+}
+
+// WithThrottler 设置 debug 请求限流，从 agent 拉取 debug span 的额度
+func WithThrottler(throttler *jaegerConfig.ThrottlerConfig) Option {
+	return func(opts *jaegerTracerOptions) {
+		opts.throttler = throttler
+	}
+}
+
 func buildOptions(opts ...Option) *jaegerTracerOptions {
 	options := newDefaultOptions()
 	for _, opt := range opts {
@@ -167,13 +531,183 @@ func newDefaultOptions() *jaegerTracerOptions {
 	return &jaegerTracerOptions{
 		log:     false,
 		disable: false,
+		global:  false,
 
 		reporterCollectorEndpoint:   "",
 		reporterQueueSize:           50,
 		reporterLogSpans:            true,
-		reporterBufferFlushInterval: 1,
+		reporterBufferFlushInterval: time.Second,
+		reporterOTLPProtocol:        OTLPProtocolHTTPProtobuf,
+		reporterOTLPCompression:     OTLPCompressionNone,
+		reporterFileMaxBackups:      fileReporterDefaultMaxBackups,
 
 		samplerType:  jaeger.SamplerTypeConst,
 		samplerParam: 1,
 	}
 }
+
+// newReporter 创建自定义 reporter，返回 nil 时使用 jaeger 默认的 agent/collector reporter
+// 自定义和文件 reporter 同时设置时都会上报，各 reporter 分别统计，记录在 t.reporters 中
+func (o *jaegerTracerOptions) newReporter(serviceName string, logger jaeger.Logger, t *Tracer) (jaeger.Reporter, error) {
+	if o.disable {
+		return nil, nil
+	}
+
+	var reporters []jaeger.Reporter
+	stats := make(map[string]*reporterStats)
+	for i, r := range o.reporters {
+		name := fmt.Sprintf("%s-%d", reporterStatsCustom, i)
+		stats[name] = &reporterStats{}
+		reporters = append(reporters, statsReporter{Reporter: r, stats: stats[name]})
+	}
+	if o.reporterFilePath != "" {
+		stats[reporterStatsFile] = &reporterStats{}
+		r, e := newFileReporter(serviceName, o.reporterFilePath, o.reporterFileMaxSize, o.reporterFileMaxBackups,
+			o.reporterQueueSize, o.reporterBufferFlushInterval, logger, jaeger.NewMetrics(stats[reporterStatsFile], nil))
+		if e != nil {
+			return nil, e
+		}
+		reporters = append(reporters, r)
+	}
+	if len(reporters) == 0 {
+		return nil, nil
+	}
+
+	t.reporters = stats
+
+	if o.reporterLogSpans && logger != nil {
+		reporters = append(reporters, jaeger.NewLoggingReporter(logger))
+	}
+	if len(reporters) == 1 {
+		return reporters[0], nil
+	}
+	return jaeger.NewCompositeReporter(reporters...), nil
+}
+
+// validate 创建追踪器前校验配置
+func (o *jaegerTracerOptions) validate() error {
+	switch o.samplerType {
+	case jaeger.SamplerTypeConst:
+		if o.samplerParam != 0 && o.samplerParam != 1 {
+			return fmt.Errorf("invalid sampler param %v for const sampler, expecting 0 or 1", o.samplerParam)
+		}
+	case jaeger.SamplerTypeProbabilistic, jaeger.SamplerTypeRemote:
+		if o.samplerParam < 0 || o.samplerParam > 1 {
+			return fmt.Errorf("invalid sampler param %v for %s sampler, expecting value between 0 and 1", o.samplerParam, o.samplerType)
+		}
+	case jaeger.SamplerTypeRateLimiting:
+	default:
+		return fmt.Errorf("unknown sampler type: %s", o.samplerType)
+	}
+	if o.samplerSamplingServerURL != "" {
+		if e := validateURL(o.samplerSamplingServerURL); e != nil {
+			return fmt.Errorf("invalid sampling server url, err:%v", e)
+		}
+	}
+	if o.samplerSamplingRefreshInterval < 0 {
+		return fmt.Errorf("invalid sampling refresh interval: %v", o.samplerSamplingRefreshInterval)
+	}
+	if o.samplerMaxOperations < 0 {
+		return fmt.Errorf("invalid sampler max operations: %d", o.samplerMaxOperations)
+	}
+
+	if o.reporterCollectorEndpoint != "" {
+		if e := validateURL(o.reporterCollectorEndpoint); e != nil {
+			return fmt.Errorf("invalid collector endpoint, err:%v", e)
+		}
+	} else if o.reporterUser != "" || o.reporterPassword != "" || len(o.reporterHTTPHeaders) > 0 {
+		return errors.New("collector basic auth and http headers require a collector endpoint")
+	}
+	if (o.reporterUser == "") != (o.reporterPassword == "") {
+		return errors.New("collector basic auth requires both user and password")
+	}
+	for k := range o.reporterHTTPHeaders {
+		if k == "" {
+			return errors.New("collector http header name cannot be empty")
+		}
+	}
+	switch o.reporterOTLPProtocol {
+	case OTLPProtocolHTTPProtobuf:
+		if o.reporterOTLPEndpoint != "" {
+			if e := validateURL(o.reporterOTLPEndpoint); e != nil {
+				return fmt.Errorf("invalid otlp endpoint, err:%v", e)
+			}
+		}
+	case OTLPProtocolGRPC:
+		if strings.Contains(o.reporterOTLPEndpoint, "://") {
+			if e := validateURL(o.reporterOTLPEndpoint); e != nil {
+				return fmt.Errorf("invalid otlp endpoint, err:%v", e)
+			}
+		} else if o.reporterOTLPEndpoint != "" {
+			if _, _, e := net.SplitHostPort(o.reporterOTLPEndpoint); e != nil {
+				return fmt.Errorf("invalid otlp endpoint, err:%v", e)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown otlp protocol: %s", o.reporterOTLPProtocol)
+	}
+	switch o.reporterOTLPCompression {
+	case OTLPCompressionNone, OTLPCompressionGzip:
+	default:
+		return fmt.Errorf("unknown otlp compression: %s", o.reporterOTLPCompression)
+	}
+	if e := o.validateOTLP(); e != nil {
+		return e
+	}
+	if o.reporterFileMaxSize < 0 {
+		return fmt.Errorf("invalid file reporter max size: %d", o.reporterFileMaxSize)
+	}
+	if o.reporterFileMaxBackups < 0 {
+		return fmt.Errorf("invalid file reporter max backups: %d", o.reporterFileMaxBackups)
+	}
+	if e := o.validateTailSampling(); e != nil {
+		return e
+	}
+	if o.samplingStrategies != nil {
+		if e := validateSamplingStrategies(o.samplingStrategies); e != nil {
+			return e
+		}
+	}
+	if o.samplingStrategies != nil && o.samplingStrategiesFile != "" {
+		return errors.New("per-operation sampling strategies and strategies file cannot be used together")
+	}
+	if o.reporterAttemptReconnectInterval < 0 {
+		return fmt.Errorf("invalid attempt reconnect interval: %v", o.reporterAttemptReconnectInterval)
+	}
+
+	for _, tag := range o.tags {
+		if tag.Key == "" {
+			return errors.New("tracer tag key cannot be empty")
+		}
+	}
+	for _, p := range o.propagations {
+		if e := validatePropagation(p); e != nil {
+			return e
+		}
+	}
+	if o.baggageRestrictions != nil && o.baggageRestrictions.HostPort != "" {
+		if _, _, e := net.SplitHostPort(o.baggageRestrictions.HostPort); e != nil {
+			return fmt.Errorf("invalid baggage restrictions host port, err:%v", e)
+		}
+	}
+	if o.throttler != nil && o.throttler.HostPort != "" {
+		if _, _, e := net.SplitHostPort(o.throttler.HostPort); e != nil {
+			return fmt.Errorf("invalid throttler host port, err:%v", e)
+		}
+	}
+	return nil
+}
+
+func validateURL(rawURL string) error {
+	u, e := url.Parse(rawURL)
+	if e != nil {
+		return e
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme in %s", rawURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %s", rawURL)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package tracetest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go/thrift"
+	"github.com/uber/jaeger-client-go/thrift-gen/agent"
+	jaegerThrift "github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"github.com/uber/jaeger-client-go/thrift-gen/zipkincore"
+	"github.com/uber/jaeger-client-go/utils"
+)
+
+// JaegerCollectorTracesPath jaeger collector 接收 thrift 数据的路径
+const JaegerCollectorTracesPath = "/api/traces"
+
+type (
+	// JaegerAgent 本地 jaeger agent，监听 UDP 并按 compact thrift 解析上报的 batch
+	// HostPort 可直接作为 NewJaegerTracer 的 jaegerHostPort
+	JaegerAgent struct {
+		jaegerBatches
+
+		conn net.PacketConn
+		done chan struct{}
+	}
+
+	// JaegerCollector 本地 jaeger collector，按 binary thrift over HTTP 解析上报的 batch
+	// Endpoint 可直接传给 trace.WithCollectorEndpoint
+	JaegerCollector struct {
+		jaegerBatches
+
+		server *httptest.Server
+	}
+
+	// jaegerBatches 记录收到的 batch 及对应的 http header
+	jaegerBatches struct {
+		mu      sync.Mutex
+		batches []*jaegerThrift.Batch
+		headers []http.Header
+	}
+
+	// agentHandler 实现 agent.Agent，只支持 jaeger 格式
+	agentHandler struct {
+		batches *jaegerBatches
+	}
+)
+
+// NewJaegerAgent 启动本地 jaeger agent，使用完需要调用 Close
+func NewJaegerAgent() (*JaegerAgent, error) {
+	conn, e := net.ListenPacket("udp", "127.0.0.1:0")
+	if e != nil {
+		return nil, e
+	}
+	a := &JaegerAgent{conn: conn, done: make(chan struct{})}
+	go a.serve()
+	return a, nil
+}
+
+// HostPort 监听地址 "127.0.0.1:port"
+func (a *JaegerAgent) HostPort() string {
+	return a.conn.LocalAddr().String()
+}
+
+// Close 关闭 agent
+func (a *JaegerAgent) Close() {
+	_ = a.conn.Close()
+	<-a.done
+}
+
+func (a *JaegerAgent) serve() {
+	defer close(a.done)
+
+	processor := agent.NewAgentProcessor(agentHandler{batches: &a.jaegerBatches})
+	protocolFactory := thrift.NewTCompactProtocolFactory()
+	buf := make([]byte, utils.UDPPacketMaxLength)
+	for {
+		n, _, e := a.conn.ReadFrom(buf)
+		if e != nil {
+			return
+		}
+		trans := thrift.NewTMemoryBufferLen(n)
+		_, _ = trans.Write(buf[:n])
+		protocol := protocolFactory.GetProtocol(trans)
+		_, _ = processor.Process(context.Background(), protocol, protocol)
+	}
+}
+
+// EmitBatch 实现 agent.Agent
+func (h agentHandler) EmitBatch(_ context.Context, batch *jaegerThrift.Batch) error {
+	h.batches.record(batch, http.Header{})
+	return nil
+}
+
+// EmitZipkinBatch 实现 agent.Agent，不支持 zipkin 格式
+func (h agentHandler) EmitZipkinBatch(context.Context, []*zipkincore.Span) error {
+	return errors.New("zipkin batch is not supported")
+}
+
+// NewJaegerCollector 启动本地 jaeger collector，使用完需要调用 Close
+func NewJaegerCollector() *JaegerCollector {
+	c := &JaegerCollector{}
+	c.server = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+// Endpoint 上报地址 "http://127.0.0.1:port/api/traces"
+func (c *JaegerCollector) Endpoint() string {
+	return c.server.URL + JaegerCollectorTracesPath
+}
+
+// Close 关闭 collector
+func (c *JaegerCollector) Close() {
+	c.server.Close()
+}
+
+func (c *JaegerCollector) handle(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != JaegerCollectorTracesPath {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Header.Get("Content-Type") != "application/x-thrift" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, e := ioutil.ReadAll(req.Body)
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	trans := thrift.NewTMemoryBufferLen(len(data))
+	_, _ = trans.Write(data)
+	batch := &jaegerThrift.Batch{}
+	if e = batch.Read(req.Context(), thrift.NewTBinaryProtocolTransport(trans)); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	c.record(batch, req.Header.Clone())
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Batches 收到的全部 batch
+func (b *jaegerBatches) Batches() []*jaegerThrift.Batch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*jaegerThrift.Batch(nil), b.batches...)
+}
+
+// Headers 每个 batch 请求的 http header，与 Batches 一一对应，agent 收到的 batch 为空 header
+func (b *jaegerBatches) Headers() []http.Header {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]http.Header(nil), b.headers...)
+}
+
+// Spans 收到的全部 span
+func (b *jaegerBatches) Spans() []*jaegerThrift.Span {
+	var spans []*jaegerThrift.Span
+	for _, batch := range b.Batches() {
+		spans = append(spans, batch.GetSpans()...)
+	}
+	return spans
+}
+
+// WaitForSpans 等待收到至少 n 个 span 或超时，返回收到的全部 span
+func (b *jaegerBatches) WaitForSpans(n int, timeout time.Duration) []*jaegerThrift.Span {
+	deadline := time.Now().Add(timeout)
+	for {
+		spans := b.Spans()
+		if len(spans) >= n || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Reset 清空已收到的 batch
+func (b *jaegerBatches) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = nil
+	b.headers = nil
+}
+
+func (b *jaegerBatches) record(batch *jaegerThrift.Batch, header http.Header) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, batch)
+	b.headers = append(b.headers, header)
+}
+
+// ThriftSpanTag 读取 thrift span 的 tag 值，不存在时返回 false
+func ThriftSpanTag(span *jaegerThrift.Span, key string) (interface{}, bool) {
+	for _, tag := range span.GetTags() {
+		if tag.GetKey() != key {
+			continue
+		}
+		switch tag.GetVType() {
+		case jaegerThrift.TagType_STRING:
+			return tag.GetVStr(), true
+		case jaegerThrift.TagType_BOOL:
+			return tag.GetVBool(), true
+		case jaegerThrift.TagType_LONG:
+			return tag.GetVLong(), true
+		case jaegerThrift.TagType_DOUBLE:
+			return tag.GetVDouble(), true
+		case jaegerThrift.TagType_BINARY:
+			return tag.GetVBinary(), true
+		}
+	}
+	return nil, false
+}
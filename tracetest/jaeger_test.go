@@ -0,0 +1,88 @@
+package tracetest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+	"github.com/qxiong522/go-jaeger-trace/tracetest"
+)
+
+func TestJaegerAgent(t *testing.T) {
+	agent, e := tracetest.NewJaegerAgent()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer agent.Close()
+
+	tracer, e := trace.NewTracer("agent-test", agent.HostPort(), trace.WithReporterLogSpans(false))
+	if e != nil {
+		t.Fatal(e)
+	}
+	parent := tracer.StartSpan("parent")
+	tracer.StartSpan("child", opentracing.ChildOf(parent.Context()), opentracing.Tag{Key: "db.rows", Value: 3}).Finish()
+	parent.Finish()
+	if e := tracer.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	spans := agent.WaitForSpans(2, 2*time.Second)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if name := agent.Batches()[0].GetProcess().GetServiceName(); name != "agent-test" {
+		t.Errorf("service name = %q", name)
+	}
+	child, parentSpan := spans[0], spans[1]
+	if child.GetOperationName() != "child" || parentSpan.GetOperationName() != "parent" {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	if child.GetTraceIdLow() != parentSpan.GetTraceIdLow() || child.GetParentSpanId() != parentSpan.GetSpanId() {
+		t.Errorf("child is not linked to parent")
+	}
+	if v, ok := tracetest.ThriftSpanTag(child, "db.rows"); !ok || v != int64(3) {
+		t.Errorf("tag db.rows = %v", v)
+	}
+	if stats := tracer.Stats(); stats.Flushed != 2 || stats.Pending() != 0 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestJaegerCollector(t *testing.T) {
+	collector := tracetest.NewJaegerCollector()
+	defer collector.Close()
+
+	tracer, e := trace.NewTracer("collector-test", "",
+		trace.WithCollectorEndpoint(collector.Endpoint()),
+		trace.WithCollectorBasicAuth("user", "secret"),
+		trace.WithCollectorHTTPHeaders(map[string]string{"X-Tenant": "test"}),
+		trace.WithReporterLogSpans(false),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tracer.StartSpan("span").Finish()
+	if e := tracer.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	spans := collector.WaitForSpans(1, 2*time.Second)
+	if len(spans) != 1 || spans[0].GetOperationName() != "span" {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	if name := collector.Batches()[0].GetProcess().GetServiceName(); name != "collector-test" {
+		t.Errorf("service name = %q", name)
+	}
+	header := collector.Headers()[0]
+	if header.Get("X-Tenant") != "test" {
+		t.Errorf("header X-Tenant = %q", header.Get("X-Tenant"))
+	}
+	if header.Get("Authorization") == "" {
+		t.Errorf("basic auth not sent: %v", header)
+	}
+	if stats := tracer.Stats(); stats.Flushed != 1 || stats.Pending() != 0 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
@@ -0,0 +1,191 @@
+// Package tracetest 链路追踪测试辅助工具
+package tracetest
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // 注册 gzip 解压
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPTracesPath OTLP/HTTP 链路数据上报路径
+const OTLPTracesPath = "/v1/traces"
+
+// OTLPReceiver 本地 OTLP 接收端，记录收到的全部上报请求，用于测试 WithOTLPEndpoint
+// OTLP/HTTP 支持 protobuf 编码及 gzip 压缩
+type OTLPReceiver struct {
+	server     *httptest.Server
+	grpcServer *grpc.Server
+	listener   net.Listener
+
+	mu       sync.Mutex
+	requests []*coltracepb.ExportTraceServiceRequest
+	headers  []http.Header
+}
+
+// otlpTraceService OTLP/gRPC TraceService 实现
+type otlpTraceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	receiver *OTLPReceiver
+}
+
+// NewOTLPReceiver 启动本地 OTLP/HTTP 接收端，使用完需要调用 Close
+func NewOTLPReceiver() *OTLPReceiver {
+	r := &OTLPReceiver{}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+// NewOTLPGRPCReceiver 启动本地 OTLP/gRPC 接收端，使用完需要调用 Close
+func NewOTLPGRPCReceiver() (*OTLPReceiver, error) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		return nil, e
+	}
+	r := &OTLPReceiver{listener: listener}
+	r.grpcServer = grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(r.grpcServer, &otlpTraceService{receiver: r})
+	go func() {
+		_ = r.grpcServer.Serve(listener)
+	}()
+	return r, nil
+}
+
+// Endpoint 上报地址，可直接传给 trace.WithOTLPEndpoint
+// OTLP/HTTP 返回 "http://127.0.0.1:port/v1/traces"，OTLP/gRPC 返回 "127.0.0.1:port"
+func (r *OTLPReceiver) Endpoint() string {
+	if r.grpcServer != nil {
+		return r.listener.Addr().String()
+	}
+	return r.server.URL + OTLPTracesPath
+}
+
+// Close 关闭接收端
+func (r *OTLPReceiver) Close() {
+	if r.grpcServer != nil {
+		r.grpcServer.Stop()
+		return
+	}
+	r.server.Close()
+}
+
+// Requests 收到的全部上报请求
+func (r *OTLPReceiver) Requests() []*coltracepb.ExportTraceServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*coltracepb.ExportTraceServiceRequest(nil), r.requests...)
+}
+
+// Headers 每个上报请求的 http header，与 Requests 一一对应
+func (r *OTLPReceiver) Headers() []http.Header {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]http.Header(nil), r.headers...)
+}
+
+// Spans 收到的全部 span
+func (r *OTLPReceiver) Spans() []*tracepb.Span {
+	var spans []*tracepb.Span
+	for _, req := range r.Requests() {
+		for _, rs := range req.GetResourceSpans() {
+			for _, ss := range rs.GetScopeSpans() {
+				spans = append(spans, ss.GetSpans()...)
+			}
+		}
+	}
+	return spans
+}
+
+// WaitForSpans 等待收到至少 n 个 span 或超时，返回收到的全部 span
+func (r *OTLPReceiver) WaitForSpans(n int, timeout time.Duration) []*tracepb.Span {
+	deadline := time.Now().Add(timeout)
+	for {
+		spans := r.Spans()
+		if len(spans) >= n || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Reset 清空已收到的请求
+func (r *OTLPReceiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+	r.headers = nil
+}
+
+func (r *OTLPReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != OTLPTracesPath {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gr, e := gzip.NewReader(req.Body)
+		if e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+	data, e := ioutil.ReadAll(body)
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	exportReq := &coltracepb.ExportTraceServiceRequest{}
+	if e = proto.Unmarshal(data, exportReq); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	r.record(exportReq, req.Header.Clone())
+
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
+
+// Export 实现 coltracepb.TraceServiceServer
+func (s *otlpTraceService) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	s.receiver.record(req, header)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (r *OTLPReceiver) record(req *coltracepb.ExportTraceServiceRequest, header http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.headers = append(r.headers, header)
+}
@@ -0,0 +1,187 @@
+package tracetest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+
+	trace "github.com/qxiong522/go-jaeger-trace"
+)
+
+// RecorderServiceName 记录用追踪器的服务名称
+const RecorderServiceName = "tracetest"
+
+// Recorder 使用内存 reporter 的追踪器，记录所有结束的 span，用于断言中间件产生的链路
+type Recorder struct {
+	*trace.Tracer
+
+	reporter *jaeger.InMemoryReporter
+}
+
+/*
+NewRecorder 创建记录用追踪器并设置为全局追踪器，全部采样
+测试结束时自动关闭追踪器并重置全局追踪器，mid 下的中间件无需改动即可被记录
+Args:
+ - opts: 额外的追踪器选项，例如 trace.WithTags
+*/
+func NewRecorder(t testing.TB, opts ...trace.Option) *Recorder {
+	t.Helper()
+
+	reporter := jaeger.NewInMemoryReporter()
+	baseOpts := []trace.Option{
+		trace.WithReporter(reporter),
+		trace.WithSamplerType(jaeger.SamplerTypeConst),
+		trace.WithSamplerParam(1),
+		trace.WithGlobal(true),
+	}
+	tracer, e := trace.NewTracer(RecorderServiceName, "", append(baseOpts, opts...)...)
+	if e != nil {
+		t.Fatalf("create recorder tracer failed, err:%v", e)
+	}
+	t.Cleanup(func() {
+		_ = tracer.Close()
+		trace.ResetGlobalTracer()
+	})
+	return &Recorder{Tracer: tracer, reporter: reporter}
+}
+
+// FinishedSpans 已结束的全部 span，按结束顺序排列
+func (r *Recorder) FinishedSpans() []*jaeger.Span {
+	spans := r.reporter.GetSpans()
+	finished := make([]*jaeger.Span, 0, len(spans))
+	for _, span := range spans {
+		if s, ok := span.(*jaeger.Span); ok {
+			finished = append(finished, s)
+		}
+	}
+	return finished
+}
+
+// SpansByName 指定 operation 名称的已结束 span
+func (r *Recorder) SpansByName(name string) []*jaeger.Span {
+	var spans []*jaeger.Span
+	for _, span := range r.FinishedSpans() {
+		if span.OperationName() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// WaitForSpans 等待至少 n 个 span 结束或超时，用于异步结束的 span
+func (r *Recorder) WaitForSpans(n int, timeout time.Duration) []*jaeger.Span {
+	deadline := time.Now().Add(timeout)
+	for {
+		spans := r.FinishedSpans()
+		if len(spans) >= n || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Reset 清空已记录的 span
+func (r *Recorder) Reset() {
+	r.reporter.Reset()
+}
+
+// AssertSpan 断言存在名称为 name 且包含全部 tags 的已结束 span，返回第一个匹配的 span，不存在时返回 nil
+func (r *Recorder) AssertSpan(t testing.TB, name string, tags ...opentracing.Tag) *jaeger.Span {
+	t.Helper()
+
+	candidates := r.SpansByName(name)
+	for _, span := range candidates {
+		if MatchTags(span, tags...) {
+			return span
+		}
+	}
+	if len(candidates) == 0 {
+		t.Errorf("no finished span named %q, finished spans: %s", name, describeSpans(r.FinishedSpans()))
+	} else {
+		t.Errorf("no finished span named %q has tags %s, candidates: %s", name, describeTags(tags), describeSpans(candidates))
+	}
+	return nil
+}
+
+// AssertNoSpan 断言不存在名称为 name 的已结束 span
+func (r *Recorder) AssertNoSpan(t testing.TB, name string) {
+	t.Helper()
+
+	if spans := r.SpansByName(name); len(spans) > 0 {
+		t.Errorf("unexpected finished span named %q: %s", name, describeSpans(spans))
+	}
+}
+
+// AssertSpanCount 断言已结束的 span 数量
+func (r *Recorder) AssertSpanCount(t testing.TB, n int) {
+	t.Helper()
+
+	if spans := r.FinishedSpans(); len(spans) != n {
+		t.Errorf("expected %d finished spans, got %d: %s", n, len(spans), describeSpans(spans))
+	}
+}
+
+// AssertParentChild 断言 child 是 parent 的子 span：同一个 trace 且 child 的 parent id 为 parent 的 span id
+func AssertParentChild(t testing.TB, parent, child *jaeger.Span) bool {
+	t.Helper()
+
+	if parent == nil || child == nil {
+		t.Errorf("cannot assert parent-child relationship on nil span")
+		return false
+	}
+	parentCtx, childCtx := parent.SpanContext(), child.SpanContext()
+	if parentCtx.TraceID() != childCtx.TraceID() {
+		t.Errorf("span %q (trace %s) and span %q (trace %s) are not in the same trace",
+			parent.OperationName(), parentCtx.TraceID(), child.OperationName(), childCtx.TraceID())
+		return false
+	}
+	if childCtx.ParentID() != parentCtx.SpanID() {
+		t.Errorf("span %q has parent %s, expected %q (%s)",
+			child.OperationName(), childCtx.ParentID(), parent.OperationName(), parentCtx.SpanID())
+		return false
+	}
+	return true
+}
+
+// MatchTags span 是否包含全部 tags，值不同类型时按字符串比较，例如 ext.SpanKindEnum 与 string
+func MatchTags(span *jaeger.Span, tags ...opentracing.Tag) bool {
+	spanTags := span.Tags()
+	for _, tag := range tags {
+		v, ok := spanTags[tag.Key]
+		if !ok {
+			return false
+		}
+		if !reflect.DeepEqual(v, tag.Value) && fmt.Sprint(v) != fmt.Sprint(tag.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeSpans(spans []*jaeger.Span) string {
+	if len(spans) == 0 {
+		return "[]"
+	}
+	desc := make([]string, 0, len(spans))
+	for _, span := range spans {
+		tags := make([]opentracing.Tag, 0, len(span.Tags()))
+		for k, v := range span.Tags() {
+			tags = append(tags, opentracing.Tag{Key: k, Value: v})
+		}
+		desc = append(desc, fmt.Sprintf("%q%s", span.OperationName(), describeTags(tags)))
+	}
+	return "[" + strings.Join(desc, ", ") + "]"
+}
+
+func describeTags(tags []opentracing.Tag) string {
+	kv := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		kv = append(kv, fmt.Sprintf("%s=%v", tag.Key, tag.Value))
+	}
+	return "{" + strings.Join(kv, " ") + "}"
+}